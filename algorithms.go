@@ -0,0 +1,279 @@
+package ssh_config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Algorithms supported by OpenSSH, as listed by "ssh -Q cipher", "ssh -Q mac",
+// "ssh -Q kex", "ssh -Q key" and "ssh -Q sig". Sourced from cipher.c, mac.c,
+// kex-names.c and sshkey.c in openssh-portable.
+var (
+	supportedCiphers = []string{
+		"3des-cbc",
+		"aes128-cbc",
+		"aes192-cbc",
+		"aes256-cbc",
+		"aes128-ctr",
+		"aes192-ctr",
+		"aes256-ctr",
+		"aes128-gcm@openssh.com",
+		"aes256-gcm@openssh.com",
+		"chacha20-poly1305@openssh.com",
+	}
+
+	supportedMACs = []string{
+		"hmac-sha1",
+		"hmac-sha1-96",
+		"hmac-sha2-256",
+		"hmac-sha2-512",
+		"hmac-md5",
+		"hmac-md5-96",
+		"umac-64@openssh.com",
+		"umac-128@openssh.com",
+		"hmac-sha1-etm@openssh.com",
+		"hmac-sha1-96-etm@openssh.com",
+		"hmac-sha2-256-etm@openssh.com",
+		"hmac-sha2-512-etm@openssh.com",
+		"hmac-md5-etm@openssh.com",
+		"hmac-md5-96-etm@openssh.com",
+		"umac-64-etm@openssh.com",
+		"umac-128-etm@openssh.com",
+	}
+
+	supportedKex = []string{
+		"diffie-hellman-group1-sha1",
+		"diffie-hellman-group14-sha1",
+		"diffie-hellman-group14-sha256",
+		"diffie-hellman-group16-sha512",
+		"diffie-hellman-group18-sha512",
+		"diffie-hellman-group-exchange-sha1",
+		"diffie-hellman-group-exchange-sha256",
+		"ecdh-sha2-nistp256",
+		"ecdh-sha2-nistp384",
+		"ecdh-sha2-nistp521",
+		"curve25519-sha256",
+		"curve25519-sha256@libssh.org",
+		"sntrup761x25519-sha512",
+		"sntrup761x25519-sha512@openssh.com",
+		"mlkem768x25519-sha256",
+	}
+
+	supportedSigs = []string{
+		"ssh-ed25519",
+		"sk-ssh-ed25519@openssh.com",
+		"ecdsa-sha2-nistp256",
+		"ecdsa-sha2-nistp384",
+		"ecdsa-sha2-nistp521",
+		"sk-ecdsa-sha2-nistp256@openssh.com",
+		"webauthn-sk-ecdsa-sha2-nistp256@openssh.com",
+		"ssh-dss",
+		"ssh-rsa",
+		"rsa-sha2-256",
+		"rsa-sha2-512",
+	}
+
+	supportedKeyTypes = append(append([]string{}, supportedSigs...),
+		"ssh-ed25519-cert-v01@openssh.com",
+		"sk-ssh-ed25519-cert-v01@openssh.com",
+		"ecdsa-sha2-nistp256-cert-v01@openssh.com",
+		"ecdsa-sha2-nistp384-cert-v01@openssh.com",
+		"ecdsa-sha2-nistp521-cert-v01@openssh.com",
+		"sk-ecdsa-sha2-nistp256-cert-v01@openssh.com",
+		"webauthn-sk-ecdsa-sha2-nistp256-cert-v01@openssh.com",
+		"ssh-dss-cert-v01@openssh.com",
+		"ssh-rsa-cert-v01@openssh.com",
+		"rsa-sha2-256-cert-v01@openssh.com",
+		"rsa-sha2-512-cert-v01@openssh.com",
+	)
+)
+
+// supportedAlgorithms maps the lowercased name of each algorithm list keyword
+// to the algorithms it accepts.
+var supportedAlgorithms = map[string][]string{
+	strings.ToLower("CASignatureAlgorithms"):       supportedSigs,
+	strings.ToLower("Ciphers"):                     supportedCiphers,
+	strings.ToLower("HostbasedAcceptedAlgorithms"): supportedKeyTypes,
+	strings.ToLower("HostKeyAlgorithms"):           supportedKeyTypes,
+	strings.ToLower("KexAlgorithms"):               supportedKex,
+	strings.ToLower("MACs"):                        supportedMACs,
+	strings.ToLower("PubkeyAcceptedAlgorithms"):    supportedKeyTypes,
+}
+
+// SupportedAlgorithms returns the algorithms that the latest release of
+// OpenSSH accepts for keyword, which is one of the algorithm list keywords
+// such as Ciphers or MACs, or nil if keyword is not an algorithm list. Use
+// Dialect.SupportedAlgorithms for older releases.
+func SupportedAlgorithms(keyword string) []string {
+	return Dialect{}.SupportedAlgorithms(keyword)
+}
+
+// UnknownAlgorithmError is returned by ResolveAlgorithms for algorithm names
+// that OpenSSH does not support.
+type UnknownAlgorithmError struct {
+	Keyword string
+	Names   []string
+}
+
+func (e *UnknownAlgorithmError) Error() string {
+	return fmt.Sprintf("ssh_config: unknown %s: %s", e.Keyword, strings.Join(e.Names, ", "))
+}
+
+// ResolveAlgorithms returns the algorithms that ssh uses for value, which was
+// set for keyword, one of the algorithm list keywords such as Ciphers or
+// HostKeyAlgorithms. As described in ssh_config(5), value may start with:
+//
+//   - "+" to append algorithms to the default list
+//   - "-" to remove algorithms from the default list
+//   - "^" to move algorithms to the front of the default list
+//
+// Otherwise value replaces the default list. The default list is
+// Default(keyword). If value is empty, the default list is returned.
+// Duplicates are removed, keeping the first.
+//
+// The names may contain the wildcards "*" and "?". In a "-" list they remove
+// every matching algorithm from the default list; otherwise, as in ssh, they
+// are replaced with every supported algorithm that matches, e.g. "aes*-ctr"
+// with aes128-ctr, aes192-ctr and aes256-ctr.
+//
+// Names that OpenSSH does not support are reported in an
+// *UnknownAlgorithmError. In that case ResolveAlgorithms returns the list
+// without those names along with the error, so callers may choose to ignore
+// names from a newer version of OpenSSH.
+//
+// ResolveAlgorithms uses the defaults and algorithms of the latest release;
+// use Dialect.ResolveAlgorithms for older releases.
+func ResolveAlgorithms(keyword, value string) ([]string, error) {
+	return Dialect{}.ResolveAlgorithms(keyword, value)
+}
+
+// resolveAlgorithms implements ResolveAlgorithms for the algorithm list
+// keyword name, with the given default list and supported algorithms.
+func resolveAlgorithms(name, value, defaultList string, supported []string) ([]string, error) {
+	def := splitAlgorithms(defaultList)
+	if value == "" {
+		return def, nil
+	}
+	var list []string
+	switch names := splitAlgorithms(value[1:]); value[0] {
+	case '+':
+		list = append(def, names...)
+	case '^':
+		list = append(names, def...)
+	case '-':
+		kept, err := removeAlgorithms(def, names)
+		if err != nil {
+			return nil, err
+		}
+		if len(kept) == 0 {
+			return nil, fmt.Errorf("ssh_config: %s %q removes every algorithm", name, value)
+		}
+		return kept, nil
+	default:
+		list = splitAlgorithms(value)
+	}
+	var unknown []string
+	algs := make([]string, 0, len(list))
+	for _, name := range list {
+		matched, err := matchAlgorithms(name, supported)
+		if err != nil {
+			return nil, err
+		}
+		if len(matched) == 0 {
+			if !contains(unknown, name) {
+				unknown = append(unknown, name)
+			}
+			continue
+		}
+		for _, alg := range matched {
+			if !contains(algs, alg) {
+				algs = append(algs, alg)
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		return algs, &UnknownAlgorithmError{Keyword: name, Names: unknown}
+	}
+	return algs, nil
+}
+
+func splitAlgorithms(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// matchAlgorithms returns the algorithms in supported that match name, which
+// may contain the wildcards "*" and "?". If name has no wildcards, it is
+// returned if it is supported.
+func matchAlgorithms(name string, supported []string) ([]string, error) {
+	if !strings.ContainsAny(name, "*?") {
+		if contains(supported, name) {
+			return []string{name}, nil
+		}
+		return nil, nil
+	}
+	p, err := NewPattern(name)
+	if err != nil {
+		return nil, err
+	}
+	var matched []string
+	for _, alg := range supported {
+		if p.regex.MatchString(alg) {
+			matched = append(matched, alg)
+		}
+	}
+	return matched, nil
+}
+
+// removeAlgorithms returns the algorithms in list that do not match any of the
+// patterns.
+func removeAlgorithms(list, patterns []string) ([]string, error) {
+	res := make([]*regexp.Regexp, len(patterns))
+	for i, pat := range patterns {
+		p, err := NewPattern(pat)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = p.regex
+	}
+	var kept []string
+outer:
+	for _, name := range list {
+		for _, re := range res {
+			if re.MatchString(name) {
+				continue outer
+			}
+		}
+		kept = append(kept, name)
+	}
+	return kept, nil
+}
+
+// GetAlgorithms returns the algorithms that ssh uses for key, one of the
+// algorithm list keywords such as Ciphers, applying a leading "+", "-" or "^"
+// to the default list; see ResolveAlgorithms. If key was not set, the default
+// list is returned. The defaults and supported algorithms are those of the
+// Dialect that the host was resolved with. As in ssh, a value set with an
+// obsolete name such as PubkeyAcceptedKeyTypes is the value for the current
+// name, and the other way around.
+//
+// If the value names algorithms that OpenSSH does not support, GetAlgorithms
+// returns the list without them along with a *ValidationError that records
+// the value's position and wraps an *UnknownAlgorithmError.
+func (r *ResolvedHost) GetAlgorithms(key string) ([]string, error) {
+	v := r.first(key)
+	if v == nil {
+		return r.dialect.ResolveAlgorithms(key, "")
+	}
+	algs, err := r.dialect.ResolveAlgorithms(key, v.value)
+	if err == nil {
+		return algs, nil
+	}
+	ve := valueError(key, v, "")
+	ve.Msg = strings.TrimPrefix(err.Error(), "ssh_config: ")
+	ve.Err = err
+	return algs, ve
+}
@@ -0,0 +1,146 @@
+package ssh_config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveAlgorithms(t *testing.T) {
+	ciphers := strings.Split(Default("Ciphers"), ",")
+	tests := []struct {
+		keyword string
+		value   string
+		want    []string
+	}{
+		{"Ciphers", "", ciphers},
+		{"Ciphers", "aes256-ctr,aes128-ctr", []string{"aes256-ctr", "aes128-ctr"}},
+		{"Ciphers", "+aes128-cbc,aes128-ctr", append(append([]string{}, ciphers...), "aes128-cbc")},
+		{"Ciphers", "^aes256-ctr", append([]string{"aes256-ctr"}, removeString(ciphers, "aes256-ctr")...)},
+		{"Ciphers", "-*-gcm@openssh.com,aes1??-ctr", []string{"chacha20-poly1305@openssh.com", "aes256-ctr"}},
+		{"KexAlgorithms", "-*sha1,sntrup*,mlkem*", removeString(strings.Split(Default("KexAlgorithms"), ","),
+			"sntrup761x25519-sha512", "sntrup761x25519-sha512@openssh.com", "mlkem768x25519-sha256")},
+		{"pubkeyacceptedkeytypes", "ssh-ed25519,ssh-ed25519", []string{"ssh-ed25519"}},
+		{"Ciphers", "aes*-ctr", []string{"aes128-ctr", "aes192-ctr", "aes256-ctr"}},
+		{"Ciphers", "aes256-ctr,aes???-ctr", []string{"aes256-ctr", "aes128-ctr", "aes192-ctr"}},
+		{"Ciphers", "+*-cbc", append(append([]string{}, ciphers...), "3des-cbc", "aes128-cbc", "aes192-cbc", "aes256-cbc")},
+		// As in ssh, patterns match every supported algorithm, not just the
+		// defaults.
+		{"Ciphers", "^aes256*", append([]string{"aes256-cbc", "aes256-ctr", "aes256-gcm@openssh.com"},
+			removeString(ciphers, "aes256-ctr", "aes256-gcm@openssh.com")...)},
+	}
+	for _, tt := range tests {
+		got, err := ResolveAlgorithms(tt.keyword, tt.value)
+		if err != nil {
+			t.Errorf("ResolveAlgorithms(%q, %q): %v", tt.keyword, tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ResolveAlgorithms(%q, %q):\ngot  %q\nwant %q", tt.keyword, tt.value, got, tt.want)
+		}
+	}
+}
+
+func removeString(list []string, remove ...string) []string {
+	var out []string
+	for _, s := range list {
+		if !contains(remove, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func TestResolveAlgorithmsErrors(t *testing.T) {
+	got, err := ResolveAlgorithms("MACs", "+hmac-sha3,hmac-sha1,umac-32@openssh.com")
+	var ue *UnknownAlgorithmError
+	if !errors.As(err, &ue) {
+		t.Fatalf("expected an *UnknownAlgorithmError, got %v", err)
+	}
+	if want := []string{"hmac-sha3", "umac-32@openssh.com"}; !reflect.DeepEqual(ue.Names, want) {
+		t.Errorf("got unknown %q, want %q", ue.Names, want)
+	}
+	if want := "ssh_config: unknown MACs: hmac-sha3, umac-32@openssh.com"; err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+	if got[len(got)-1] != "hmac-sha1" {
+		t.Errorf("expected known names to be kept, got %q", got)
+	}
+
+	got, err = ResolveAlgorithms("Ciphers", "aes*-ctr,blowfish*")
+	if !errors.As(err, &ue) || !reflect.DeepEqual(ue.Names, []string{"blowfish*"}) {
+		t.Errorf("expected a pattern that matches nothing to be reported, got %v", err)
+	}
+	if want := []string{"aes128-ctr", "aes192-ctr", "aes256-ctr"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := ResolveAlgorithms("Ciphers", "-*"); err == nil {
+		t.Error("expected an error for a list that removes every algorithm")
+	}
+	if _, err := ResolveAlgorithms("Port", "22"); err == nil {
+		t.Error("expected an error for a keyword that is not an algorithm list")
+	}
+}
+
+func TestDefaultAlgorithmsSupported(t *testing.T) {
+	for _, kw := range Keywords() {
+		if kw.Type != ValueAlgorithms {
+			continue
+		}
+		if len(SupportedAlgorithms(kw.Name)) == 0 {
+			t.Errorf("%s: no supported algorithms", kw.Name)
+		}
+		if _, err := ResolveAlgorithms(kw.Name, kw.Default); err != nil {
+			t.Errorf("%s: default is not supported: %v", kw.Name, err)
+		}
+	}
+}
+
+func TestGetAlgorithms(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Host web\n    Ciphers +aes128-cbc,des-cbc\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	algs, err := r.GetAlgorithms("Ciphers")
+	var ve *ValidationError
+	var ue *UnknownAlgorithmError
+	if !errors.As(err, &ve) || !errors.As(err, &ue) {
+		t.Fatalf("expected a *ValidationError wrapping an *UnknownAlgorithmError, got %v", err)
+	}
+	if want := "(2, 13): ssh_config: unknown Ciphers: des-cbc"; err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+	if algs[len(algs)-1] != "aes128-cbc" {
+		t.Errorf("got %q", algs)
+	}
+	macs, err := r.GetAlgorithms("MACs")
+	if err != nil || strings.Join(macs, ",") != Default("MACs") {
+		t.Errorf("GetAlgorithms(MACs): got %q, %v", macs, err)
+	}
+}
+
+func TestGetAlgorithmsAlias(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Host web\n    PubkeyAcceptedKeyTypes +ssh-rsa\n\nHost *\n    PubkeyAcceptedAlgorithms ssh-ed25519\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(strings.Split(Default("PubkeyAcceptedAlgorithms"), ","), "ssh-rsa")
+	for _, key := range []string{"PubkeyAcceptedAlgorithms", "PubkeyAcceptedKeyTypes"} {
+		got, err := r.GetAlgorithms(key)
+		if err != nil {
+			t.Fatalf("GetAlgorithms(%s): %v", key, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GetAlgorithms(%s):\ngot  %q\nwant %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package ssh_config
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Resolver looks up host names during hostname canonicalization. The
+// *net.Resolver type implements Resolver; tests and callers that do not want
+// to use the network can provide their own.
+type Resolver interface {
+	// LookupHost returns the addresses for host. host is always fully
+	// qualified, with a trailing ".". An error or an empty result means the
+	// host does not exist.
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+	// LookupCNAME returns the canonical name for host, which may have a
+	// trailing ".".
+	LookupCNAME(ctx context.Context, host string) (cname string, err error)
+}
+
+// cnameRule is a single rule from CanonicalizePermittedCNAMEs. A CNAME is
+// followed if the name being canonicalized matches source and the CNAME
+// matches target.
+type cnameRule struct {
+	source []*Pattern
+	target []*Pattern
+}
+
+func parseCNAMERules(val string) ([]cnameRule, error) {
+	if strings.EqualFold(val, "none") {
+		return nil, nil
+	}
+	fields := strings.Fields(val)
+	rules := make([]cnameRule, 0, len(fields))
+	for _, field := range fields {
+		idx := strings.IndexByte(field, ':')
+		if idx <= 0 || idx == len(field)-1 {
+			return nil, fmt.Errorf("ssh_config: invalid CanonicalizePermittedCNAMEs rule %q", field)
+		}
+		source, err := parsePatternList([]string{strings.ToLower(field[:idx])})
+		if err != nil {
+			return nil, err
+		}
+		target, err := parsePatternList([]string{strings.ToLower(field[idx+1:])})
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, cnameRule{source: source, target: target})
+	}
+	return rules, nil
+}
+
+// isAddr reports whether host looks like an IP address, in which case it is
+// never canonicalized. This is the same check as is_addr_fast in ssh.
+func isAddr(host string) bool {
+	if strings.ContainsAny(host, "%:") {
+		return true
+	}
+	return strings.Trim(host, "0123456789.") == ""
+}
+
+// getOrDefault returns the value for key, or its default if key was not set.
+func (r *ResolvedHost) getOrDefault(key string) string {
+	if r.Has(key) {
+		return r.Get(key)
+	}
+	return Default(key)
+}
+
+// direct reports whether ssh will connect to the host itself, rather than
+// through a ProxyCommand or ProxyJump.
+func (r *ResolvedHost) direct() bool {
+	for _, key := range []string{"ProxyCommand", "ProxyJump"} {
+		if val := r.Get(key); val != "" && !strings.EqualFold(val, "none") {
+			return false
+		}
+	}
+	return true
+}
+
+// Canonicalize returns the canonical name for host, using the
+// CanonicalizeHostname, CanonicalDomains, CanonicalizeMaxDots,
+// CanonicalizeFallbackLocal and CanonicalizePermittedCNAMEs settings in r.
+// host is usually the HostName for r, lowercased.
+//
+// Canonicalize follows the same rules as ssh. If canonicalization is disabled,
+// host is an IP address, or host has more than CanonicalizeMaxDots dots,
+// host is returned unchanged. Otherwise each of the CanonicalDomains is
+// appended to host in turn, and the first name that res can look up is
+// returned. If the lookup returns a CNAME that is allowed by
+// CanonicalizePermittedCNAMEs, the CNAME is returned instead.
+//
+// CanonicalizePermittedCNAMEs is not checked if canonicalization is disabled,
+// and nothing is looked up. ssh still resolves the name to connect to it, but
+// check_follow_cname in ssh.c does not replace it with a CNAME unless
+// CanonicalizeHostname is enabled, so the result is the same.
+//
+// If no name could be found, Canonicalize returns host unchanged if
+// CanonicalizeFallbackLocal is enabled, or an error otherwise.
+func (r *ResolvedHost) Canonicalize(ctx context.Context, res Resolver, host string) (string, error) {
+	if host == "" {
+		return host, nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	if isAddr(host) {
+		return host, nil
+	}
+	mode := strings.ToLower(r.getOrDefault("CanonicalizeHostname"))
+	if !canonicalizeEnabled(mode) {
+		return host, nil
+	}
+	direct := r.direct()
+	if !direct && mode != "always" {
+		// Don't canonicalize names that will be interpreted by a proxy
+		// unless the user asked for it.
+		return host, nil
+	}
+	rules, err := parseCNAMERules(r.Get("CanonicalizePermittedCNAMEs"))
+	if err != nil {
+		return "", err
+	}
+
+	var candidates []string
+	if strings.HasSuffix(host, ".") {
+		candidates = []string{host}
+	} else {
+		maxDots, err := strconv.Atoi(r.getOrDefault("CanonicalizeMaxDots"))
+		if err != nil {
+			return "", fmt.Errorf("ssh_config: invalid CanonicalizeMaxDots: %v", err)
+		}
+		if strings.Count(host, ".") > maxDots {
+			return host, nil
+		}
+		for _, domain := range strings.Fields(r.Get("CanonicalDomains")) {
+			if strings.EqualFold(domain, "none") {
+				break
+			}
+			candidates = append(candidates, host+"."+domain+".")
+		}
+	}
+	for _, fullhost := range candidates {
+		addrs, err := res.LookupHost(ctx, fullhost)
+		if err != nil || len(addrs) == 0 {
+			continue
+		}
+		name := strings.TrimSuffix(fullhost, ".")
+		if len(rules) > 0 {
+			name = followCNAME(ctx, res, rules, name, fullhost)
+		}
+		return name, nil
+	}
+
+	if fallback := strings.ToLower(r.getOrDefault("CanonicalizeFallbackLocal")); fallback == "no" || fallback == "false" {
+		return "", fmt.Errorf("ssh_config: could not resolve host %q", host)
+	}
+	// ssh looks up the bare host name with the system resolver's search
+	// rules so that CanonicalizePermittedCNAMEs can still apply.
+	if len(rules) > 0 {
+		return followCNAME(ctx, res, rules, host, host), nil
+	}
+	return host, nil
+}
+
+// canonicalizeEnabled reports whether mode, the lowercased value of
+// CanonicalizeHostname, turns canonicalization on.
+func canonicalizeEnabled(mode string) bool {
+	return mode != "" && mode != "no" && mode != "false"
+}
+
+// followCNAME returns the CNAME for lookup if one of rules permits name to be
+// replaced with it, and name otherwise.
+func followCNAME(ctx context.Context, res Resolver, rules []cnameRule, name, lookup string) string {
+	cname, err := res.LookupCNAME(ctx, lookup)
+	if err != nil {
+		return name
+	}
+	cname = strings.ToLower(strings.TrimSuffix(cname, "."))
+	if cname == "" || cname == name {
+		return name
+	}
+	for _, rule := range rules {
+		if matchPatterns(rule.source, name) && matchPatterns(rule.target, cname) {
+			return cname
+		}
+	}
+	return name
+}
@@ -0,0 +1,176 @@
+package ssh_config
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeResolver is an in-memory Resolver. hosts holds the fully qualified names
+// that exist, and cnames maps a name to its canonical name.
+type fakeResolver struct {
+	hosts   map[string]bool
+	cnames  map[string]string
+	lookups []string
+}
+
+func (f *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	f.lookups = append(f.lookups, host)
+	if !f.hosts[host] {
+		return nil, errors.New("no such host")
+	}
+	return []string{"192.0.2.1"}, nil
+}
+
+func (f *fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if cname, ok := f.cnames[host]; ok {
+		return cname, nil
+	}
+	return host, nil
+}
+
+func newFakeResolver() *fakeResolver {
+	return &fakeResolver{
+		hosts: map[string]bool{
+			"web.example.com.":      true,
+			"db.internal.example.":  true,
+			"mail.example.com.":     true,
+			"anchored.example.org.": true,
+			"alias.example.com.":    true,
+			"proxied.example.com.":  true,
+			"two.dots.example.com.": true,
+			"a.b.c.example.com.":    true,
+		},
+		cnames: map[string]string{
+			"alias.example.com.": "Real.Example.NET.",
+			"mail.example.com.":  "mx.other.net.",
+		},
+	}
+}
+
+var canonicalizeTests = []struct {
+	config string
+	host   string
+	want   string
+	err    string
+}{
+	{"CanonicalizeHostname no\nCanonicalDomains example.com", "web", "web", ""},
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com", "web", "web.example.com", ""},
+	{"CanonicalizeHostname yes\nCanonicalDomains example.org internal.example", "db", "db.internal.example", ""},
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com", "anchored.example.org.", "anchored.example.org", ""},
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com", "192.0.2.1", "192.0.2.1", ""},
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com", "2001:DB8::1", "2001:db8::1", ""},
+	// More dots than CanonicalizeMaxDots.
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com", "two.dots", "two.dots.example.com", ""},
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com\nCanonicalizeMaxDots 0", "two.dots", "two.dots", ""},
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com", "a.b.c", "a.b.c", ""},
+	{"CanonicalizeHostname true\nCanonicalDomains example.com", "two.dots", "two.dots.example.com", ""},
+	{"CanonicalizeHostname false\nCanonicalDomains example.com", "two.dots", "two.dots", ""},
+	// Not found.
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com", "missing", "missing", ""},
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com\nCanonicalizeFallbackLocal no", "missing", "", `ssh_config: could not resolve host "missing"`},
+	// Names that will be passed to a proxy are only canonicalized with
+	// "always".
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com\nProxyJump bastion", "proxied", "proxied", ""},
+	{"CanonicalizeHostname always\nCanonicalDomains example.com\nProxyJump bastion", "proxied", "proxied.example.com", ""},
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com\nProxyCommand none", "proxied", "proxied.example.com", ""},
+	// CNAMEs are only followed if a rule permits it.
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com", "alias", "alias.example.com", ""},
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com\nCanonicalizePermittedCNAMEs *.example.com:*.example.net", "alias", "real.example.net", ""},
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com\nCanonicalizePermittedCNAMEs *.example.com:*.example.net", "mail", "mail.example.com", ""},
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com\nCanonicalizePermittedCNAMEs *.example.com:*.example.net,*.other.net", "mail", "mx.other.net", ""},
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com\nCanonicalizePermittedCNAMEs none", "alias", "alias.example.com", ""},
+	{"CanonicalizeHostname yes\nCanonicalDomains example.com\nCanonicalizePermittedCNAMEs example.com", "alias", "", `ssh_config: invalid CanonicalizePermittedCNAMEs rule "example.com"`},
+}
+
+func TestCanonicalize(t *testing.T) {
+	for _, tt := range canonicalizeTests {
+		cfg, err := Decode(strings.NewReader(tt.config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := cfg.Resolve(tt.host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := r.Canonicalize(context.Background(), newFakeResolver(), tt.host)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Canonicalize(%q) with %q: got err %v, want %q", tt.host, tt.config, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Canonicalize(%q) with %q: %v", tt.host, tt.config, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Canonicalize(%q) with %q: got %q, want %q", tt.host, tt.config, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalizeDisabledIgnoresCNAMEs(t *testing.T) {
+	for _, mode := range []string{"yes", "no"} {
+		cfg, err := Decode(strings.NewReader("CanonicalizeHostname " + mode + "\nCanonicalizePermittedCNAMEs *.example.com:*.example.net\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := cfg.Resolve("alias.example.com.")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := newFakeResolver()
+		got, err := r.Canonicalize(context.Background(), res, "alias.example.com.")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, lookups := "real.example.net", 1
+		if mode == "no" {
+			want, lookups = "alias.example.com.", 0
+		}
+		if got != want || len(res.lookups) != lookups {
+			t.Errorf("CanonicalizeHostname %s: got %q after %d lookups, want %q after %d", mode, got, len(res.lookups), want, lookups)
+		}
+	}
+}
+
+func TestResolveFinalCanonicalize(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(`Host *
+    CanonicalizeHostname yes
+    CanonicalDomains example.org example.com
+
+Match canonical host *.example.com
+    User web
+
+Match canonical
+    Port 2222
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := newFakeResolver()
+	ctx := NewMatchContext("WEB")
+	ctx.Resolver = res
+	r, err := cfg.ResolveFinal(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.CanonicalHost != "web.example.com" {
+		t.Errorf("CanonicalHost: got %q, want web.example.com", r.CanonicalHost)
+	}
+	if got := r.HostName(); got != "web.example.com" {
+		t.Errorf("HostName(): got %q", got)
+	}
+	if got := r.User(); got != "web" {
+		t.Errorf("User: got %q, want web", got)
+	}
+	if got := r.Get("Port"); got != "2222" {
+		t.Errorf("Port: got %q, want 2222", got)
+	}
+	want := []string{"web.example.org.", "web.example.com."}
+	if strings.Join(res.lookups, " ") != strings.Join(want, " ") {
+		t.Errorf("lookups: got %q, want %q", res.lookups, want)
+	}
+}
@@ -35,7 +35,6 @@ import (
 	osuser "os/user"
 	"path/filepath"
 	"regexp"
-	"runtime"
 	"strings"
 	"sync"
 )
@@ -49,7 +48,16 @@ type configFinder func() string
 // UserSettings checks ~/.ssh and /etc/ssh for configuration files. The config
 // files are parsed and cached the first time Get() or GetStrict() is called.
 type UserSettings struct {
-	IgnoreErrors       bool
+	IgnoreErrors bool
+	// Executor runs the command for "Match exec" criteria. If Executor is
+	// nil, commands are never run and Match blocks with an exec criterion do
+	// not apply. See ShellExecutor.
+	Executor Executor
+	// Dialect is the OpenSSH release whose default values are returned for
+	// keywords that are not set, e.g. Dialect{Major: 7, Minor: 4} for a host
+	// running OpenSSH 7.4. The zero Dialect uses the defaults of the latest
+	// release. See ParseDialect.
+	Dialect            Dialect
 	customConfig       *Config
 	customConfigFinder configFinder
 	systemConfig       *Config
@@ -86,25 +94,36 @@ func systemConfigFinder() string {
 	return filepath.Join("/", "etc", "ssh", "ssh_config")
 }
 
-func findVal(c *Config, alias, key string) (string, error) {
+// matchContext returns ctx with u.Executor set, if ctx does not already have
+// an Executor.
+func (u *UserSettings) matchContext(ctx *MatchContext) *MatchContext {
+	if ctx.Executor != nil || u.Executor == nil {
+		return ctx
+	}
+	c := *ctx
+	c.Executor = u.Executor
+	return &c
+}
+
+func findVal(c *Config, ctx *MatchContext, seen *ResolvedHost, key string) (string, error) {
 	if c == nil {
 		return "", nil
 	}
-	val, err := c.Get(alias, key)
-	if err != nil || val == "" {
+	srcs, err := c.lookup(ctx, seen, key, false, nil)
+	if err != nil || len(srcs) == 0 || srcs[0].Value == "" {
 		return "", err
 	}
-	if err := validate(key, val); err != nil {
+	if err := validateKV(srcs[0].File, srcs[0].KV); err != nil {
 		return "", err
 	}
-	return val, nil
+	return srcs[0].Value, nil
 }
 
-func findAll(c *Config, alias, key string) ([]string, error) {
+func findAll(c *Config, ctx *MatchContext, seen *ResolvedHost, key string) ([]string, error) {
 	if c == nil {
 		return nil, nil
 	}
-	return c.GetAll(alias, key)
+	return c.getAll(ctx, seen, key)
 }
 
 // Get finds the first value for key within a declaration that matches the
@@ -202,28 +221,35 @@ func (u *UserSettings) GetStrict(alias, key string) (string, error) {
 	if u.onceErr != nil && u.IgnoreErrors == false {
 		return "", u.onceErr
 	}
+	ctx := u.matchContext(NewMatchContext(alias))
+	// Values set in earlier files apply to Match blocks in later ones, as in
+	// Resolve.
+	seen := newResolvedHost(alias)
 	// TODO this is getting repetitive
 	if u.customConfig != nil {
-		val, err := findVal(u.customConfig, alias, key)
+		val, err := findVal(u.customConfig, ctx, seen, key)
 		if err != nil || val != "" {
 			return val, err
 		}
 	}
-	val, err := findVal(u.userConfig, alias, key)
+	val, err := findVal(u.userConfig, ctx, seen, key)
 	if err != nil || val != "" {
 		return val, err
 	}
-	val2, err2 := findVal(u.systemConfig, alias, key)
+	val2, err2 := findVal(u.systemConfig, ctx, seen, key)
 	if err2 != nil || val2 != "" {
 		return val2, err2
 	}
-	return Default(key), nil
+	return u.Dialect.Default(key), nil
 }
 
 // GetAllStrict retrieves zero or more directives for key for the given alias.
 // If key has a default value and no matching configuration is found, the
-// default will be returned. For more information on default values and the way
-// patterns are matched, see the manpage for ssh_config.
+// default will be returned. Path lists such as UserKnownHostsFile are split
+// into one element per path, and keywords such as IdentityFile that default
+// to several files return each file as a separate element; see DefaultAll.
+// For more information on default values and the way patterns are matched,
+// see the manpage for ssh_config.
 //
 // The returned error will be non-nil if and only if a user's configuration file
 // or the system configuration file could not be parsed, and u.IgnoreErrors is
@@ -234,23 +260,24 @@ func (u *UserSettings) GetAllStrict(alias, key string) ([]string, error) {
 	if u.onceErr != nil && u.IgnoreErrors == false {
 		return nil, u.onceErr
 	}
+	ctx := u.matchContext(NewMatchContext(alias))
+	seen := newResolvedHost(alias)
 	if u.customConfig != nil {
-		val, err := findAll(u.customConfig, alias, key)
+		val, err := findAll(u.customConfig, ctx, seen, key)
 		if err != nil || val != nil {
 			return val, err
 		}
 	}
-	val, err := findAll(u.userConfig, alias, key)
+	val, err := findAll(u.userConfig, ctx, seen, key)
 	if err != nil || val != nil {
 		return val, err
 	}
-	val2, err2 := findAll(u.systemConfig, alias, key)
+	val2, err2 := findAll(u.systemConfig, ctx, seen, key)
 	if err2 != nil || val2 != nil {
 		return val2, err2
 	}
-	// TODO: IdentityFile has multiple default values that we should return.
-	if def := Default(key); def != "" {
-		return []string{def}, nil
+	if defs := u.Dialect.DefaultAll(key); defs != nil {
+		return defs, nil
 	}
 	return []string{}, nil
 }
@@ -308,15 +335,29 @@ func (u *UserSettings) doLoadConfigs() {
 }
 
 func parseFile(filename string) (*Config, error) {
-	return parseWithDepth(filename, 0)
+	return parseWithDepth(filename, 0, DecodeOptions{})
 }
 
-func parseWithDepth(filename string, depth uint8) (*Config, error) {
+// parseWithDepth reads filename. If opts.Recover is set and the file contains
+// errors, it returns the partial Config along with a ParseErrors.
+func parseWithDepth(filename string, depth uint8, opts DecodeOptions) (*Config, error) {
 	b, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	return decodeBytes(b, isSystem(filename), depth)
+	c, err := decodeBytes(b, isSystem(filename), depth, opts)
+	switch e := err.(type) {
+	case *ParseError:
+		e.setFile(filename)
+	case ParseErrors:
+		for _, pe := range e {
+			pe.setFile(filename)
+		}
+	}
+	if c != nil {
+		c.filename = filename
+	}
+	return c, err
 }
 
 func isSystem(filename string) bool {
@@ -331,31 +372,59 @@ func Decode(r io.Reader) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	return decodeBytes(b, false, 0)
+	return decodeBytes(b, false, 0, DecodeOptions{})
 }
 
 // DecodeBytes reads b into a Config, or returns an error if r could not be
 // parsed as an SSH config file.
 func DecodeBytes(b []byte) (*Config, error) {
-	return decodeBytes(b, false, 0)
+	return decodeBytes(b, false, 0, DecodeOptions{})
+}
+
+// DecodeOptions control how DecodeWithOptions parses a config file.
+type DecodeOptions struct {
+	// Recover keeps parsing after a line that cannot be parsed, instead of
+	// stopping at the first error. The line is kept in the Config as an
+	// Invalid node, so that the Config prints back out unchanged. Files read
+	// by Include directives are parsed the same way.
+	Recover bool
 }
 
-func decodeBytes(b []byte, system bool, depth uint8) (c *Config, err error) {
+// DecodeWithOptions reads r into a Config using opts.
+//
+// If opts.Recover is set and r contains lines that cannot be parsed,
+// DecodeWithOptions returns the partial Config along with a ParseErrors that
+// lists every problem, in the order they were found. Lines with errors are
+// ignored by Get and Resolve. A Host or Match line with an error starts a
+// block that never matches, so the keywords under it do not apply to any
+// host. Errors reading r are returned with a nil Config.
+func DecodeWithOptions(r io.Reader, opts DecodeOptions) (*Config, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBytes(b, false, 0, opts)
+}
+
+// decodeBytes parses b. If opts.Recover is set and b contains errors, it
+// returns the partial Config along with a ParseErrors; otherwise the Config
+// is nil if there is an error.
+func decodeBytes(b []byte, system bool, depth uint8, opts DecodeOptions) (c *Config, err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			if _, ok := r.(runtime.Error); ok {
-				panic(r)
-			}
-			if e, ok := r.(error); ok && e == ErrDepthExceeded {
-				err = e
+			if e, ok := r.(*ParseError); ok {
+				c, err = nil, e
 				return
 			}
-			err = errors.New(r.(string))
+			panic(r)
 		}
 	}()
 
-	c = parseSSH(lexSSH(b), system, depth)
-	return c, err
+	c, errs := parseSSH(lexSSH(b), system, depth, opts, b)
+	if len(errs) > 0 {
+		return c, errs
+	}
+	return c, nil
 }
 
 // Config represents an SSH config file.
@@ -365,6 +434,8 @@ type Config struct {
 	Hosts    []*Host
 	depth    uint8
 	position Position
+	// filename is the file the Config was read from, if any.
+	filename string
 }
 
 // Get finds the first value in the configuration that matches the alias and
@@ -373,65 +444,89 @@ type Config struct {
 //
 // The match for key is case insensitive.
 func (c *Config) Get(alias, key string) (string, error) {
-	lowerKey := strings.ToLower(key)
-	for _, host := range c.Hosts {
-		if !host.Matches(alias) {
-			continue
-		}
-		for _, node := range host.Nodes {
-			switch t := node.(type) {
-			case *Empty:
-				continue
-			case *KV:
-				// "keys are case insensitive" per the spec
-				lkey := strings.ToLower(t.Key)
-				if lkey == lowerKey {
-					return t.Value, nil
-				}
-			case *Include:
-				val := t.Get(alias, key)
-				if val != "" {
-					return val, nil
-				}
-			default:
-				return "", fmt.Errorf("unknown Node type %v", t)
-			}
-		}
+	return c.get(NewMatchContext(alias), key)
+}
+
+func (c *Config) get(ctx *MatchContext, key string) (string, error) {
+	srcs, err := c.lookup(ctx, nil, key, false, nil)
+	if err != nil || len(srcs) == 0 {
+		return "", err
 	}
-	return "", nil
+	return srcs[0].Value, nil
 }
 
 // GetAll returns all values in the configuration that match the alias and
-// contains key, or nil if none are present.
+// contains key, or nil if none are present. Path lists such as
+// UserKnownHostsFile are split into one element per path.
 func (c *Config) GetAll(alias, key string) ([]string, error) {
-	lowerKey := strings.ToLower(key)
+	return c.getAll(NewMatchContext(alias), nil, key)
+}
+
+func (c *Config) getAll(ctx *MatchContext, seen *ResolvedHost, key string) ([]string, error) {
+	srcs, err := c.lookup(ctx, seen, key, true, nil)
+	if err != nil {
+		return nil, err
+	}
 	all := []string(nil)
+	for _, src := range srcs {
+		all = appendValue(all, key, src.Value, src.KV)
+	}
+	return all, nil
+}
+
+// lookup returns the Source for the first value of key that applies to ctx,
+// or for every value if all is true. chain is the list of files whose Include
+// directives led to c.
+//
+// seen records every value set by the blocks that applied so far, so that
+// Match blocks see the User and HostName set earlier, as in Resolve. Callers
+// that look in several files pass the same seen to each; if seen is nil, a
+// new one is used.
+func (c *Config) lookup(ctx *MatchContext, seen *ResolvedHost, key string, all bool, chain []string) ([]*Source, error) {
+	if seen == nil {
+		seen = newResolvedHost(ctx.OriginalHost)
+	}
+	lowerKey := canonicalKey(key)
+	var srcs []*Source
 	for _, host := range c.Hosts {
-		if !host.Matches(alias) {
+		ok, err := host.matchesContext(matchContextFor(ctx, seen))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
 			continue
 		}
 		for _, node := range host.Nodes {
 			switch t := node.(type) {
-			case *Empty:
+			case *Empty, *Invalid:
 				continue
 			case *KV:
-				// "keys are case insensitive" per the spec
-				lkey := strings.ToLower(t.Key)
-				if lkey == lowerKey {
-					all = append(all, t.Value)
+				seen.set(t.Key, t.Value, nil, 0)
+				// "keys are case insensitive" per the spec, and an obsolete
+				// alias is the same keyword as its current name.
+				if canonicalKey(t.Key) != lowerKey {
+					continue
 				}
+				src := newSource(t, c.filename, host, chain)
+				if !all {
+					return []*Source{src}, nil
+				}
+				srcs = append(srcs, src)
 			case *Include:
-				val, _ := t.GetAll(alias, key)
-				if len(val) > 0 {
-					all = append(all, val...)
+				found, err := t.lookup(ctx, seen, key, all, append(chain[:len(chain):len(chain)], c.filename))
+				if err != nil {
+					return nil, err
+				}
+				if !all && len(found) > 0 {
+					return found, nil
 				}
+				srcs = append(srcs, found...)
 			default:
 				return nil, fmt.Errorf("unknown Node type %v", t)
 			}
 		}
 	}
-
-	return all, nil
+	return srcs, nil
 }
 
 // String returns a string representation of the Config file.
@@ -490,7 +585,7 @@ func special(b byte) bool {
 //	Host 192.168.0.?
 func NewPattern(s string) (*Pattern, error) {
 	if s == "" {
-		return nil, errors.New("ssh_config: empty pattern")
+		return nil, fmt.Errorf("%w: empty pattern", ErrInvalidPattern)
 	}
 	negated := false
 	if s[0] == '!' {
@@ -517,14 +612,17 @@ func NewPattern(s string) (*Pattern, error) {
 	buf.WriteByte('$')
 	r, err := regexp.Compile(buf.String())
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidPattern, s, err)
 	}
 	return &Pattern{str: s, regex: r, not: negated}, nil
 }
 
 // Host describes a Host or Match directive and the keywords that follow it.
 type Host struct {
-	// A list of host patterns that should match this host.
+	// A list of host patterns that should match this host. For a Match
+	// directive, Patterns holds the patterns for "Match host" or "Match all"
+	// if that is the only criterion on the line, and is nil otherwise; use
+	// Criteria instead.
 	Patterns []*Pattern
 	// A Node is either a key/value pair or a comment line.
 	Nodes []Node
@@ -537,33 +635,51 @@ type Host struct {
 	leadingSpace int // TODO: handle spaces vs tabs here.
 	// The file starts with an implicit "Host *" declaration.
 	implicit bool
+	// Criteria are the criteria on a Match line, all of which must match for
+	// the block to apply. Criteria is nil for Host blocks.
+	Criteria []*MatchCriterion
 	// isMatch is true if this block was created by a Match directive.
-	isMatch bool
-	// matchKeyword stores the original text after "Match" (e.g. "Host" or
-	// "all") so we can round-trip correctly.
-	matchKeyword string
+	isMatch  bool
+	position Position
+	// invalid is the Host or Match line, if it could not be parsed. An
+	// invalid block never matches.
+	invalid *Invalid
+}
+
+// Pos returns h's Position: the position of the Host or Match keyword. The
+// Position is invalid for the implicit block at the top of a file and for
+// blocks that were not read from a file.
+func (h *Host) Pos() Position {
+	return h.position
 }
 
 // Matches returns true if the Host matches for the given alias. For
 // a description of the rules that provide a match, see the manpage for
 // ssh_config.
+//
+// Matches evaluates Match blocks against NewMatchContext(alias); use
+// MatchesContext to control the values that are matched.
 func (h *Host) Matches(alias string) bool {
-	found := false
-	for i := range h.Patterns {
-		if h.Patterns[i].regex.MatchString(alias) {
-			if h.Patterns[i].not {
-				// Negated match. "A pattern entry may be negated by prefixing
-				// it with an exclamation mark (`!'). If a negated entry is
-				// matched, then the Host entry is ignored, regardless of
-				// whether any other patterns on the line match. Negated matches
-				// are therefore useful to provide exceptions for wildcard
-				// matches."
-				return false
-			}
-			found = true
-		}
+	return h.MatchesContext(NewMatchContext(alias))
+}
+
+// MatchesContext returns true if the Host or Match block applies to the
+// values in ctx. A Match block with an exec criterion does not apply if
+// ctx.Executor is nil or the command could not be run.
+func (h *Host) MatchesContext(ctx *MatchContext) bool {
+	ok, err := h.matchesContext(ctx)
+	return ok && err == nil
+}
+
+func (h *Host) matchesContext(ctx *MatchContext) (bool, error) {
+	if h.invalid != nil {
+		return false, nil
 	}
-	return found
+	if h.isMatch {
+		ok, _, err := matchCriteria(h.Criteria, ctx)
+		return ok, err
+	}
+	return matchPatterns(h.Patterns, ctx.host()), nil
 }
 
 // String prints h as it would appear in a config file. Minor tweaks may be
@@ -571,7 +687,10 @@ func (h *Host) Matches(alias string) bool {
 func (h *Host) String() string {
 	var buf strings.Builder
 	//lint:ignore S1002 I prefer to write it this way
-	if h.implicit == false {
+	if h.invalid != nil {
+		buf.WriteString(h.invalid.String())
+		buf.WriteByte('\n')
+	} else if h.implicit == false {
 		buf.WriteString(strings.Repeat(" ", int(h.leadingSpace)))
 		if h.isMatch {
 			buf.WriteString("Match")
@@ -580,15 +699,11 @@ func (h *Host) String() string {
 			} else {
 				buf.WriteString(" ")
 			}
-			buf.WriteString(h.matchKeyword)
-			if !strings.EqualFold(h.matchKeyword, "all") {
-				buf.WriteString(" ")
-				for i, pat := range h.Patterns {
-					buf.WriteString(pat.String())
-					if i < len(h.Patterns)-1 {
-						buf.WriteString(" ")
-					}
+			for i, c := range h.Criteria {
+				if i > 0 {
+					buf.WriteByte(' ')
 				}
+				buf.WriteString(c.String())
 			}
 		} else {
 			buf.WriteString("Host")
@@ -639,6 +754,9 @@ type KV struct {
 	hasEquals       bool
 	leadingSpace    int // Space before the key. TODO handle spaces vs tabs.
 	position        Position
+	// valuePosition is the position of the value, which is used to report
+	// validation errors.
+	valuePosition Position
 	// rawValue preserves the original value text (including surrounding double
 	// quotes, if any) so that String() can roundtrip the config file faithfully.
 	rawValue string
@@ -649,6 +767,15 @@ func (k *KV) Pos() Position {
 	return k.position
 }
 
+// valuePos returns the position of k's value, or of k if the value's position
+// is not known.
+func (k *KV) valuePos() Position {
+	if k.valuePosition.Invalid() {
+		return k.position
+	}
+	return k.valuePosition
+}
+
 // String prints k as it was parsed in the config file.
 func (k *KV) String() string {
 	if k == nil {
@@ -699,6 +826,27 @@ func (e *Empty) String() string {
 	return fmt.Sprintf("%s#%s", strings.Repeat(" ", int(e.leadingSpace)), e.Comment)
 }
 
+// Invalid is a line in the config file that could not be parsed. Invalid
+// nodes are only created by DecodeWithOptions with Recover set. They are
+// ignored when looking up values, and are printed exactly as they appeared in
+// the file.
+type Invalid struct {
+	// Err describes the problem with the line.
+	Err      *ParseError
+	line     string
+	position Position
+}
+
+// Pos returns the position of the start of the line.
+func (i *Invalid) Pos() Position {
+	return i.position
+}
+
+// String prints the line as it appeared in the config file.
+func (i *Invalid) String() string {
+	return i.line
+}
+
 // Include holds the result of an Include directive, including the config files
 // that have been parsed as part of that directive. At most 5 levels of Include
 // statements will be parsed.
@@ -748,6 +896,13 @@ func removeDups(arr []string) []string {
 // Any error encountered while parsing nested configuration files will be
 // returned.
 func NewInclude(directives []string, hasEquals bool, pos Position, comment string, system bool, depth uint8) (*Include, error) {
+	return newInclude(directives, hasEquals, pos, comment, system, depth, DecodeOptions{})
+}
+
+// newInclude is like NewInclude, but parses the included files with opts. If
+// opts.Recover is set and the included files contain errors, it returns the
+// Include along with a ParseErrors.
+func newInclude(directives []string, hasEquals bool, pos Position, comment string, system bool, depth uint8, opts DecodeOptions) (*Include, error) {
 	if depth > maxRecurseDepth {
 		return nil, ErrDepthExceeded
 	}
@@ -775,19 +930,25 @@ func NewInclude(directives []string, hasEquals bool, pos Position, comment strin
 		}
 		theseMatches, err := filepath.Glob(path)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%w %q: %v", ErrIncludeGlob, directives[i], err)
 		}
 		matches = append(matches, theseMatches...)
 	}
 	matches = removeDups(matches)
 	inc.matches = matches
+	var errs ParseErrors
 	for i := range matches {
-		config, err := parseWithDepth(matches[i], depth)
-		if err != nil {
+		config, err := parseWithDepth(matches[i], depth, opts)
+		if nested, ok := err.(ParseErrors); ok && config != nil {
+			errs = append(errs, nested...)
+		} else if err != nil {
 			return nil, err
 		}
 		inc.files[matches[i]] = config
 	}
+	if len(errs) > 0 {
+		return inc, errs
+	}
 	return inc, nil
 }
 
@@ -797,30 +958,45 @@ func (i *Include) Pos() Position {
 }
 
 // Get finds the first value in the Include statement matching the alias and the
-// given key.
+// given key. It returns the empty string if the included files return an error.
 func (inc *Include) Get(alias, key string) string {
-	inc.mu.Lock()
-	defer inc.mu.Unlock()
-	// TODO: we search files in any order which is not correct
-	for i := range inc.matches {
-		cfg := inc.files[inc.matches[i]]
-		if cfg == nil {
-			panic("nil cfg")
-		}
-		val, err := cfg.Get(alias, key)
-		if err == nil && val != "" {
-			return val
-		}
+	return inc.get(NewMatchContext(alias), key)
+}
+
+func (inc *Include) get(ctx *MatchContext, key string) string {
+	srcs, err := inc.lookup(ctx, newResolvedHost(ctx.OriginalHost), key, false, nil)
+	if err != nil || len(srcs) == 0 {
+		return ""
 	}
-	return ""
+	return srcs[0].Value
 }
 
 // GetAll finds all values in the Include statement matching the alias and the
-// given key.
+// given key. Path lists such as UserKnownHostsFile are split into one element
+// per path.
 func (inc *Include) GetAll(alias, key string) ([]string, error) {
+	return inc.getAll(NewMatchContext(alias), key)
+}
+
+func (inc *Include) getAll(ctx *MatchContext, key string) ([]string, error) {
+	srcs, err := inc.lookup(ctx, newResolvedHost(ctx.OriginalHost), key, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	var vals []string
+	for _, src := range srcs {
+		vals = appendValue(vals, key, src.Value, src.KV)
+	}
+	return vals, nil
+}
+
+// lookup returns the Source for the first non-empty value of key in the
+// included files, or for every value if all is true. As with Config.lookup, an
+// error from any of the files is returned.
+func (inc *Include) lookup(ctx *MatchContext, seen *ResolvedHost, key string, all bool, chain []string) ([]*Source, error) {
 	inc.mu.Lock()
 	defer inc.mu.Unlock()
-	var vals []string
+	var srcs []*Source
 
 	// TODO: we search files in any order which is not correct
 	for i := range inc.matches {
@@ -828,16 +1004,26 @@ func (inc *Include) GetAll(alias, key string) ([]string, error) {
 		if cfg == nil {
 			panic("nil cfg")
 		}
-		val, err := cfg.GetAll(alias, key)
-		if err == nil && len(val) != 0 {
-			// In theory if SupportsMultiple was false for this key we could
-			// stop looking here. But the caller has asked us to find all
-			// instances of the keyword (and could use Get() if they wanted) so
-			// let's keep looking.
-			vals = append(vals, val...)
+		found, err := cfg.lookup(ctx, seen, key, all, chain)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			continue
 		}
+		if !all {
+			if found[0].Value != "" {
+				return found, nil
+			}
+			continue
+		}
+		// In theory if SupportsMultiple was false for this key we could
+		// stop looking here. But the caller has asked us to find all
+		// instances of the keyword (and could use Get() if they wanted) so
+		// let's keep looking.
+		srcs = append(srcs, found...)
 	}
-	return vals, nil
+	return srcs, nil
 }
 
 // String prints out a string representation of this Include directive. Note
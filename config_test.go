@@ -2,9 +2,11 @@ package ssh_config
 
 import (
 	"bytes"
+	"errors"
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -110,26 +112,61 @@ func TestGetIdentities(t *testing.T) {
 	if err != nil {
 		t.Errorf("expected nil err, got %v", err)
 	}
-	if len(val) != len(defaultIdentityFiles) {
-		// TODO: return the right values here.
-		log.Printf("expected defaults, got %v", val)
-	} else {
-		for i, v := range defaultIdentityFiles {
-			if val[i] != v {
-				t.Errorf("invalid %d in val, expected %s got %s", i, v, val[i])
-			}
-		}
+	if !reflect.DeepEqual(val, defaultIdentityFiles) {
+		t.Errorf("expected defaults %v, got %v", defaultIdentityFiles, val)
 	}
 
 	// "protocol1" host sets Protocol 1, but Protocol is ignored in modern
 	// OpenSSH (only SSH2 exists). No IdentityFile is set for this host, so
-	// the result is empty (IdentityFile has no single default value).
+	// the protocol 2 defaults are returned.
 	val, err = us.GetAllStrict("protocol1", "IdentityFile")
 	if err != nil {
 		t.Errorf("expected nil err, got %v", err)
 	}
-	if len(val) != 0 {
-		t.Errorf("expected [], got %v", val)
+	if !reflect.DeepEqual(val, defaultIdentityFiles) {
+		t.Errorf("expected defaults %v, got %v", defaultIdentityFiles, val)
+	}
+
+	val, err = us.GetAllStrict("randomhost", "UserKnownHostsFile")
+	if err != nil {
+		t.Errorf("expected nil err, got %v", err)
+	}
+	if want := []string{"~/.ssh/known_hosts", "~/.ssh/known_hosts2"}; !reflect.DeepEqual(val, want) {
+		t.Errorf("expected %v, got %v", want, val)
+	}
+}
+
+func TestGetAllPathListsMatchResolve(t *testing.T) {
+	us := &UserSettings{
+		userConfigFinder:   testConfigFinder("testdata/known-hosts"),
+		systemConfigFinder: nullConfigFinder,
+	}
+	tests := []struct {
+		alias string
+		key   string
+		want  []string
+	}{
+		{"randomhost", "UserKnownHostsFile", []string{"~/.ssh/known_hosts", "~/.ssh/known_hosts2"}},
+		{"randomhost", "GlobalKnownHostsFile", []string{"/etc/ssh/ssh_known_hosts", "/etc/ssh/ssh_known_hosts2"}},
+		{"quoted", "UserKnownHostsFile", []string{"~/.ssh/known_hosts", "/etc/ssh/known hosts"}},
+		{"single", "UserKnownHostsFile", []string{"/dev/null"}},
+		{"single", "GlobalKnownHostsFile", []string{"/etc/ssh/ssh_known_hosts", "/etc/ssh/extra_known_hosts"}},
+	}
+	for _, tt := range tests {
+		got, err := us.GetAllStrict(tt.alias, tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetAllStrict(%q, %q): got %q, want %q", tt.alias, tt.key, got, tt.want)
+		}
+		r, err := us.Resolve(tt.alias)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.GetAll(tt.key); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Resolve(%q).GetAll(%q): got %q, want %q", tt.alias, tt.key, got, tt.want)
+		}
 	}
 }
 
@@ -200,9 +237,16 @@ func TestGetInvalidPort(t *testing.T) {
 	if val != "" {
 		t.Errorf("expected to get '' for val, got %q", val)
 	}
-	if err.Error() != `ssh_config: strconv.ParseUint: parsing "notanumber": invalid syntax` {
+	if err.Error() != `testdata/invalid-port (2, 8): ssh_config: strconv.ParseUint: parsing "notanumber": invalid syntax` {
 		t.Errorf("wrong error: got %v", err)
 	}
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected a *ValidationError, got %T", err)
+	}
+	if ve.Key != "Port" || ve.Value != "notanumber" || ve.Pos != (Position{Line: 2, Col: 8}) {
+		t.Errorf("wrong ValidationError: got %+v", ve)
+	}
 }
 
 func TestGetNotFoundNoDefault(t *testing.T) {
@@ -381,9 +425,16 @@ func TestIncludeRecursive(t *testing.T) {
 		userConfigFinder: testConfigFinder("testdata/include-recursive"),
 	}
 	val, err := us.GetStrict("kevinburke.ssh_config.test.example.com", "Port")
-	if err != ErrDepthExceeded {
+	if !errors.Is(err, ErrDepthExceeded) {
 		t.Errorf("Recursive include: expected ErrDepthExceeded, got %v", err)
 	}
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Recursive include: expected a *ParseError, got %T", err)
+	}
+	if pe.File != testPath || len(pe.IncludeChain) == 0 || pe.IncludeChain[0] != "testdata/include-recursive" {
+		t.Errorf("Recursive include: got File %q and IncludeChain %q", pe.File, pe.IncludeChain)
+	}
 	if val != "" {
 		t.Errorf("non-empty string value %s", val)
 	}
@@ -433,6 +484,46 @@ func TestIncludeShellHomeDirectory(t *testing.T) {
 	}
 }
 
+func TestIncludeErrorsPropagate(t *testing.T) {
+	const data = "Match exec \"check\"\n    Port 2222\n"
+	top, err := Decode(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := Decode(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inc := &Include{
+		directives: []string{"inner"},
+		matches:    []string{"inner"},
+		files:      map[string]*Config{"inner": inner},
+	}
+	outer := NewConfig()
+	outer.Hosts[0].Nodes = append(outer.Hosts[0].Nodes, inc)
+
+	ctx := NewMatchContext("web")
+	ctx.Executor = &recordingExecutor{err: errors.New("exec: not found")}
+	want := `ssh_config: Match exec "check": exec: not found`
+	for _, tt := range []struct {
+		name string
+		cfg  *Config
+	}{{"top level", top}, {"included", outer}} {
+		if _, err := tt.cfg.get(ctx, "Port"); err == nil || err.Error() != want {
+			t.Errorf("%s: Get: got error %v, want %q", tt.name, err, want)
+		}
+		if _, err := tt.cfg.getAll(ctx, nil, "Port"); err == nil || err.Error() != want {
+			t.Errorf("%s: GetAll: got error %v, want %q", tt.name, err, want)
+		}
+		if _, err := tt.cfg.ResolveContext(ctx); err == nil || err.Error() != want {
+			t.Errorf("%s: ResolveContext: got error %v, want %q", tt.name, err, want)
+		}
+	}
+	if _, err := inc.getAll(ctx, "Port"); err == nil || err.Error() != want {
+		t.Errorf("Include.GetAll: got error %v, want %q", err, want)
+	}
+}
+
 var matchTests = []struct {
 	in    []string
 	alias string
@@ -472,15 +563,19 @@ func TestMatches(t *testing.T) {
 	}
 }
 
-func TestMatchExecUnsupported(t *testing.T) {
+func TestMatchExecSkippedByDefault(t *testing.T) {
 	config := `Match Exec "echo hello"
     Port 2222`
-	_, err := Decode(strings.NewReader(config))
-	if err == nil {
-		t.Fatal("expected Match Exec to error, didn't")
+	cfg, err := Decode(strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
 	}
-	if !strings.Contains(err.Error(), "ssh_config: Match Exec is not supported") {
-		t.Errorf("wrong error: %v", err)
+	val, err := cfg.Get("example.com", "Port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "" {
+		t.Errorf("expected Match Exec block to be skipped, got Port %q", val)
 	}
 }
 
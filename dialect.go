@@ -0,0 +1,296 @@
+package ssh_config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dialect is an OpenSSH release. Default values, the keywords that are
+// accepted, and the supported algorithms all differ between releases, so a
+// config that is used by an older ssh should be resolved with the Dialect for
+// that release.
+//
+// The zero Dialect is the latest release that this package knows about; see
+// LatestDialect.
+type Dialect struct {
+	Major int
+	Minor int
+}
+
+// LatestDialect is the release that the default values in this package are
+// taken from.
+var LatestDialect = Dialect{Major: 10, Minor: 0}
+
+// ParseDialect parses an OpenSSH version such as "7.4", "8.9p1" or the output
+// of "ssh -V", e.g. "OpenSSH_7.4p1, OpenSSL 1.0.2k-fips  26 Jan 2017".
+func ParseDialect(version string) (Dialect, error) {
+	s := strings.TrimSpace(version)
+	if i := strings.IndexFunc(s, func(r rune) bool { return r >= '0' && r <= '9' }); i > 0 {
+		s = s[i:]
+	}
+	end := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if end >= 0 {
+		s = s[:end]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 2 {
+		return Dialect{}, fmt.Errorf("ssh_config: invalid OpenSSH version %q", version)
+	}
+	major, err1 := strconv.Atoi(parts[0])
+	minor, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || major < 1 {
+		return Dialect{}, fmt.Errorf("ssh_config: invalid OpenSSH version %q", version)
+	}
+	return Dialect{Major: major, Minor: minor}, nil
+}
+
+func mustParseDialect(version string) Dialect {
+	d, err := ParseDialect(version)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// String returns the version, e.g. "7.4".
+func (d Dialect) String() string {
+	d = d.orLatest()
+	return fmt.Sprintf("%d.%d", d.Major, d.Minor)
+}
+
+// orLatest returns LatestDialect if d is the zero Dialect.
+func (d Dialect) orLatest() Dialect {
+	if d == (Dialect{}) {
+		return LatestDialect
+	}
+	return d
+}
+
+// before reports whether d is an earlier release than version, which is a
+// version from the catalog such as "8.5". An empty version is never later.
+func (d Dialect) before(version string) bool {
+	if version == "" {
+		return false
+	}
+	v := mustParseDialect(version)
+	d = d.orLatest()
+	return d.Major < v.Major || (d.Major == v.Major && d.Minor < v.Minor)
+}
+
+// Supports reports whether keyword is accepted by d: it was added in or before
+// d, and was not deprecated or removed in or before d. The obsolete names in
+// Keyword.Aliases are accepted by every release.
+func (d Dialect) Supports(keyword string) bool {
+	kw, ok := LookupKeyword(keyword)
+	if !ok {
+		return false
+	}
+	if !strings.EqualFold(kw.Name, keyword) {
+		return true
+	}
+	return !d.before(kw.Since) && (kw.Deprecated == "" || d.before(kw.Deprecated))
+}
+
+// defaultChange records that, in releases before until, the default value for
+// key was value.
+type defaultChange struct {
+	key   string
+	until string
+	value string
+}
+
+// defaultHistory lists the default values that have changed since OpenSSH
+// 7.4, sourced from the release notes and from the history of readconf.c and
+// myproposal.h in openssh-portable. For each key, the entries are sorted by
+// until. The current values are in defaults.
+var defaultHistory = []defaultChange{
+	{strings.ToLower("CASignatureAlgorithms"), "8.2", "ecdsa-sha2-nistp256,ecdsa-sha2-nistp384,ecdsa-sha2-nistp521,ssh-ed25519,rsa-sha2-512,rsa-sha2-256,ssh-rsa"},
+	{strings.ToLower("CASignatureAlgorithms"), "8.8", "ecdsa-sha2-nistp256,ecdsa-sha2-nistp384,ecdsa-sha2-nistp521,sk-ecdsa-sha2-nistp256@openssh.com,ssh-ed25519,sk-ssh-ed25519@openssh.com,rsa-sha2-512,rsa-sha2-256,ssh-rsa"},
+
+	{strings.ToLower("CheckHostIP"), "8.5", "yes"},
+
+	{strings.ToLower("Cipher"), "7.6", "3des"},
+	{strings.ToLower("Ciphers"), "7.6", "chacha20-poly1305@openssh.com,aes128-ctr,aes192-ctr,aes256-ctr,aes128-gcm@openssh.com,aes256-gcm@openssh.com,aes128-cbc,aes192-cbc,aes256-cbc"},
+	{strings.ToLower("Ciphers"), "10.0", "chacha20-poly1305@openssh.com,aes128-ctr,aes192-ctr,aes256-ctr,aes128-gcm@openssh.com,aes256-gcm@openssh.com"},
+	{strings.ToLower("CompressionLevel"), "7.6", "6"},
+
+	// HostKeyAlgorithms, HostbasedAcceptedAlgorithms and
+	// PubkeyAcceptedAlgorithms all default to KEX_DEFAULT_PK_ALG.
+	{strings.ToLower("HostbasedAcceptedAlgorithms"), "8.2", pkAlg74},
+	{strings.ToLower("HostbasedAcceptedAlgorithms"), "8.5", pkAlg82},
+	{strings.ToLower("HostbasedAcceptedAlgorithms"), "8.8", pkAlg85},
+	{strings.ToLower("HostKeyAlgorithms"), "8.2", pkAlg74},
+	{strings.ToLower("HostKeyAlgorithms"), "8.5", pkAlg82},
+	{strings.ToLower("HostKeyAlgorithms"), "8.8", pkAlg85},
+	{strings.ToLower("PubkeyAcceptedAlgorithms"), "8.2", pkAlg74},
+	{strings.ToLower("PubkeyAcceptedAlgorithms"), "8.5", pkAlg82},
+	{strings.ToLower("PubkeyAcceptedAlgorithms"), "8.8", pkAlg85},
+
+	{strings.ToLower("KexAlgorithms"), "8.2", "curve25519-sha256,curve25519-sha256@libssh.org,ecdh-sha2-nistp256,ecdh-sha2-nistp384,ecdh-sha2-nistp521,diffie-hellman-group-exchange-sha256,diffie-hellman-group16-sha512,diffie-hellman-group18-sha512,diffie-hellman-group-exchange-sha1,diffie-hellman-group14-sha256,diffie-hellman-group14-sha1"},
+	{strings.ToLower("KexAlgorithms"), "9.0", kex82},
+	{strings.ToLower("KexAlgorithms"), "10.0", "sntrup761x25519-sha512@openssh.com," + kex82},
+
+	{strings.ToLower("Protocol"), "7.6", "2"},
+	{strings.ToLower("RhostsRSAAuthentication"), "7.6", "no"},
+	{strings.ToLower("RSAAuthentication"), "7.6", "yes"},
+	{strings.ToLower("UpdateHostKeys"), "8.5", "no"},
+	{strings.ToLower("UsePrivilegedPort"), "7.5", "no"},
+}
+
+// listDefaultHistory is like defaultHistory, for the keywords in listDefaults.
+var listDefaultHistory = []struct {
+	key    string
+	until  string
+	values []string
+}{
+	{strings.ToLower("IdentityFile"), "8.2", []string{"~/.ssh/id_rsa", "~/.ssh/id_dsa", "~/.ssh/id_ecdsa", "~/.ssh/id_ed25519"}},
+	{strings.ToLower("IdentityFile"), "10.0", []string{"~/.ssh/id_rsa", "~/.ssh/id_dsa", "~/.ssh/id_ecdsa", "~/.ssh/id_ecdsa_sk", "~/.ssh/id_ed25519", "~/.ssh/id_ed25519_sk"}},
+}
+
+// Earlier values of KEX_DEFAULT_PK_ALG and KEX_CLIENT_KEX in myproposal.h.
+const (
+	pkAlg74 = "ecdsa-sha2-nistp256-cert-v01@openssh.com,ecdsa-sha2-nistp384-cert-v01@openssh.com,ecdsa-sha2-nistp521-cert-v01@openssh.com,ssh-ed25519-cert-v01@openssh.com,ssh-rsa-cert-v01@openssh.com,ecdsa-sha2-nistp256,ecdsa-sha2-nistp384,ecdsa-sha2-nistp521,ssh-ed25519,rsa-sha2-512,rsa-sha2-256,ssh-rsa"
+	pkAlg82 = "ecdsa-sha2-nistp256-cert-v01@openssh.com,ecdsa-sha2-nistp384-cert-v01@openssh.com,ecdsa-sha2-nistp521-cert-v01@openssh.com,sk-ecdsa-sha2-nistp256-cert-v01@openssh.com,ssh-ed25519-cert-v01@openssh.com,sk-ssh-ed25519-cert-v01@openssh.com,rsa-sha2-512-cert-v01@openssh.com,rsa-sha2-256-cert-v01@openssh.com,ssh-rsa-cert-v01@openssh.com,ecdsa-sha2-nistp256,ecdsa-sha2-nistp384,ecdsa-sha2-nistp521,sk-ecdsa-sha2-nistp256@openssh.com,ssh-ed25519,sk-ssh-ed25519@openssh.com,rsa-sha2-512,rsa-sha2-256,ssh-rsa"
+	pkAlg85 = "ssh-ed25519-cert-v01@openssh.com,ecdsa-sha2-nistp256-cert-v01@openssh.com,ecdsa-sha2-nistp384-cert-v01@openssh.com,ecdsa-sha2-nistp521-cert-v01@openssh.com,sk-ssh-ed25519-cert-v01@openssh.com,sk-ecdsa-sha2-nistp256-cert-v01@openssh.com,rsa-sha2-512-cert-v01@openssh.com,rsa-sha2-256-cert-v01@openssh.com,ssh-rsa-cert-v01@openssh.com,ssh-ed25519,ecdsa-sha2-nistp256,ecdsa-sha2-nistp384,ecdsa-sha2-nistp521,sk-ssh-ed25519@openssh.com,sk-ecdsa-sha2-nistp256@openssh.com,rsa-sha2-512,rsa-sha2-256,ssh-rsa"
+	kex82   = "curve25519-sha256,curve25519-sha256@libssh.org,ecdh-sha2-nistp256,ecdh-sha2-nistp384,ecdh-sha2-nistp521,diffie-hellman-group-exchange-sha256,diffie-hellman-group16-sha512,diffie-hellman-group18-sha512,diffie-hellman-group14-sha256"
+)
+
+// Default returns the default value for keyword in d, or the empty string if
+// keyword has no default or is not supported by d. Keyword matching is case
+// insensitive. An obsolete name for a keyword has the same default as the
+// keyword.
+//
+// For the zero Dialect, Default is the same as the Default function.
+func (d Dialect) Default(keyword string) string {
+	if d == (Dialect{}) {
+		return Default(keyword)
+	}
+	if !d.Supports(keyword) {
+		return ""
+	}
+	kw, _ := LookupKeyword(keyword)
+	lkey := strings.ToLower(kw.Name)
+	for _, c := range defaultHistory {
+		if c.key == lkey && d.before(c.until) {
+			return c.value
+		}
+	}
+	return defaults[lkey]
+}
+
+// DefaultAll is like Default, but returns each default value for keyword as a
+// separate element. See the DefaultAll function.
+//
+// For the zero Dialect, DefaultAll is the same as the DefaultAll function.
+func (d Dialect) DefaultAll(keyword string) []string {
+	if d == (Dialect{}) {
+		return DefaultAll(keyword)
+	}
+	if !d.Supports(keyword) {
+		return nil
+	}
+	kw, _ := LookupKeyword(keyword)
+	lkey := strings.ToLower(kw.Name)
+	if list, ok := listDefaults[lkey]; ok {
+		for _, c := range listDefaultHistory {
+			if c.key == lkey && d.before(c.until) {
+				list = c.values
+				break
+			}
+		}
+		return append([]string(nil), list...)
+	}
+	if def := d.Default(keyword); def != "" {
+		return []string{def}
+	}
+	return nil
+}
+
+// DefaultsFor returns the default value of every keyword that has one in the
+// given OpenSSH version, such as "7.4p1", keyed by lowercased keyword. The
+// obsolete names of keywords are included, as they are in Default.
+func DefaultsFor(version string) (map[string]string, error) {
+	d, err := ParseDialect(version)
+	if err != nil {
+		return nil, err
+	}
+	return d.defaults(), nil
+}
+
+// defaults returns the default value of every keyword that has one in d.
+func (d Dialect) defaults() map[string]string {
+	if d == (Dialect{}) {
+		return defaults
+	}
+	m := make(map[string]string)
+	for _, kw := range keywords {
+		for _, name := range append([]string{kw.Name}, kw.Aliases...) {
+			if val := d.Default(name); val != "" {
+				m[strings.ToLower(name)] = val
+			}
+		}
+	}
+	return m
+}
+
+// algorithmVersions records the releases that added or removed algorithms
+// that are in the supported lists. Algorithms that are not listed here are
+// supported by every release since 7.4.
+var algorithmVersions = map[string]struct{ since, until string }{
+	"mlkem768x25519-sha256":                                {since: "9.9"},
+	"sntrup761x25519-sha512":                               {since: "9.9"},
+	"sntrup761x25519-sha512@openssh.com":                   {since: "8.5"},
+	"sk-ssh-ed25519@openssh.com":                           {since: "8.2"},
+	"sk-ssh-ed25519-cert-v01@openssh.com":                  {since: "8.2"},
+	"sk-ecdsa-sha2-nistp256@openssh.com":                   {since: "8.2"},
+	"sk-ecdsa-sha2-nistp256-cert-v01@openssh.com":          {since: "8.2"},
+	"webauthn-sk-ecdsa-sha2-nistp256@openssh.com":          {since: "8.4"},
+	"webauthn-sk-ecdsa-sha2-nistp256-cert-v01@openssh.com": {since: "8.4"},
+	"rsa-sha2-256-cert-v01@openssh.com":                    {since: "7.8"},
+	"rsa-sha2-512-cert-v01@openssh.com":                    {since: "7.8"},
+	"ssh-dss":                                              {until: "10.0"},
+	"ssh-dss-cert-v01@openssh.com":                         {until: "10.0"},
+}
+
+// SupportedAlgorithms returns the algorithms that d accepts for keyword, which
+// is one of the algorithm list keywords such as Ciphers or MACs, or nil if
+// keyword is not an algorithm list.
+func (d Dialect) SupportedAlgorithms(keyword string) []string {
+	kw, ok := LookupKeyword(keyword)
+	if !ok {
+		return nil
+	}
+	var algs []string
+	for _, name := range supportedAlgorithms[strings.ToLower(kw.Name)] {
+		v := algorithmVersions[name]
+		if !d.before(v.since) && (v.until == "" || d.before(v.until)) {
+			algs = append(algs, name)
+		}
+	}
+	return algs
+}
+
+// ResolveAlgorithms is like the ResolveAlgorithms function, but uses the
+// default list and the supported algorithms of d.
+func (d Dialect) ResolveAlgorithms(keyword, value string) ([]string, error) {
+	kw, ok := LookupKeyword(keyword)
+	if !ok || kw.Type != ValueAlgorithms {
+		return nil, fmt.Errorf("ssh_config: %s is not an algorithm list", keyword)
+	}
+	if !d.Supports(keyword) {
+		return nil, fmt.Errorf("ssh_config: %s is not supported by OpenSSH %s", keyword, d)
+	}
+	return resolveAlgorithms(kw.Name, value, d.Default(keyword), d.SupportedAlgorithms(keyword))
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,249 @@
+package ssh_config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDialect(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Dialect
+		err  bool
+	}{
+		{"7.4", Dialect{7, 4}, false},
+		{"8.9p1", Dialect{8, 9}, false},
+		{"OpenSSH_7.4p1, OpenSSL 1.0.2k-fips  26 Jan 2017", Dialect{7, 4}, false},
+		{" 10.0 ", Dialect{10, 0}, false},
+		{"", Dialect{}, true},
+		{"7", Dialect{}, true},
+		{"7.4.1", Dialect{}, true},
+		{"OpenSSH", Dialect{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDialect(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseDialect(%q): got err %v, want error %t", tt.in, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDialect(%q): got %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	if s := (Dialect{}).String(); s != LatestDialect.String() {
+		t.Errorf("zero Dialect: got %q, want %q", s, LatestDialect.String())
+	}
+}
+
+func TestDialectSupports(t *testing.T) {
+	d74 := Dialect{7, 4}
+	tests := []struct {
+		d       Dialect
+		keyword string
+		want    bool
+	}{
+		{d74, "Protocol", true},
+		{d74, "UsePrivilegedPort", true},
+		{d74, "PubkeyAcceptedKeyTypes", true},
+		{d74, "PubkeyAcceptedAlgorithms", false},
+		{d74, "CASignatureAlgorithms", false},
+		{Dialect{7, 5}, "UsePrivilegedPort", false},
+		{Dialect{8, 5}, "PubkeyAcceptedAlgorithms", true},
+		{Dialect{}, "Protocol", false},
+		{Dialect{}, "PubkeyAcceptedKeyTypes", true},
+		{Dialect{}, "NotAKeyword", false},
+	}
+	for _, tt := range tests {
+		if got := tt.d.Supports(tt.keyword); got != tt.want {
+			t.Errorf("Dialect %v: Supports(%q): got %t, want %t", tt.d, tt.keyword, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultsFor(t *testing.T) {
+	defs, err := DefaultsFor("OpenSSH_7.4p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"checkhostip":            "yes",
+		"protocol":               "2",
+		"updatehostkeys":         "no",
+		"port":                   "22",
+		"pubkeyacceptedkeytypes": pkAlg74,
+	} {
+		if got := defs[key]; got != want {
+			t.Errorf("DefaultsFor(7.4)[%q]: got %q, want %q", key, got, want)
+		}
+	}
+	if !strings.Contains(defs["ciphers"], "aes128-cbc") {
+		t.Errorf("DefaultsFor(7.4): ciphers %q should include CBC ciphers", defs["ciphers"])
+	}
+	for _, key := range []string{"pubkeyacceptedalgorithms", "casignaturealgorithms"} {
+		if v, ok := defs[key]; ok {
+			t.Errorf("DefaultsFor(7.4): %s should not be set, got %q", key, v)
+		}
+	}
+
+	if _, err := DefaultsFor("latest"); err == nil {
+		t.Error("DefaultsFor(latest): expected an error")
+	}
+
+	// The defaults for the latest release should match Default, except for
+	// obsolete names, which Default only knows about when they were renamed
+	// without changing their default.
+	latest, err := DefaultsFor(LatestDialect.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, val := range defaults {
+		if latest[key] != val {
+			t.Errorf("DefaultsFor(%v)[%q]: got %q, want %q", LatestDialect, key, latest[key], val)
+		}
+	}
+	for key, val := range latest {
+		if _, ok := defaults[key]; !ok && key != "challengeresponseauthentication" {
+			t.Errorf("DefaultsFor(%v)[%q] = %q, but Default(%q) is empty", LatestDialect, key, val, key)
+		}
+	}
+}
+
+func TestDialectDefaultAll(t *testing.T) {
+	tests := []struct {
+		d    Dialect
+		want []string
+	}{
+		{Dialect{7, 4}, []string{"~/.ssh/id_rsa", "~/.ssh/id_dsa", "~/.ssh/id_ecdsa", "~/.ssh/id_ed25519"}},
+		{Dialect{8, 2}, []string{"~/.ssh/id_rsa", "~/.ssh/id_dsa", "~/.ssh/id_ecdsa", "~/.ssh/id_ecdsa_sk", "~/.ssh/id_ed25519", "~/.ssh/id_ed25519_sk"}},
+		{Dialect{10, 0}, defaultIdentityFiles},
+		{Dialect{}, defaultIdentityFiles},
+	}
+	for _, tt := range tests {
+		if got := tt.d.DefaultAll("IdentityFile"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Dialect %v: DefaultAll(IdentityFile): got %v, want %v", tt.d, got, tt.want)
+		}
+	}
+	if got, want := (Dialect{7, 4}).DefaultAll("CheckHostIP"), []string{"yes"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DefaultAll(CheckHostIP): got %v, want %v", got, want)
+	}
+	if got := (Dialect{7, 4}).DefaultAll("CASignatureAlgorithms"); got != nil {
+		t.Errorf("DefaultAll(CASignatureAlgorithms): got %v, want nil", got)
+	}
+
+	u := &UserSettings{
+		userConfigFinder:   testConfigFinder("testdata/identities"),
+		systemConfigFinder: nullConfigFinder,
+		Dialect:            Dialect{7, 4},
+	}
+	r, err := u.Resolve("randomhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.IdentityFiles(); !reflect.DeepEqual(got, tests[0].want) {
+		t.Errorf("Resolve: IdentityFiles: got %v, want %v", got, tests[0].want)
+	}
+	r, err = u.Resolve("hasidentity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.IdentityFiles(), []string{"file1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve: IdentityFiles: got %v, want %v", got, want)
+	}
+}
+
+func TestDefaultHistoryValid(t *testing.T) {
+	for _, c := range defaultHistory {
+		if _, ok := LookupKeyword(c.key); !ok {
+			t.Errorf("history for unknown keyword %q", c.key)
+		}
+		if err := validate(c.key, c.value); err != nil {
+			t.Errorf("history value for %s until %s is invalid: %v", c.key, c.until, err)
+		}
+		d := mustParseDialect(c.until)
+		if !d.Supports(c.key) && d.before(LatestDialect.String()) {
+			// Removed keywords keep the value they had when they were removed.
+			continue
+		}
+		for _, name := range splitAlgorithms(c.value) {
+			kw, _ := LookupKeyword(c.key)
+			if kw.Type == ValueAlgorithms && !contains(supportedAlgorithms[c.key], name) {
+				t.Errorf("history value for %s until %s: unknown algorithm %q", c.key, c.until, name)
+			}
+		}
+	}
+}
+
+func TestDialectSupportedAlgorithms(t *testing.T) {
+	kex := Dialect{7, 4}.SupportedAlgorithms("KexAlgorithms")
+	for _, name := range []string{"mlkem768x25519-sha256", "sntrup761x25519-sha512@openssh.com"} {
+		if contains(kex, name) {
+			t.Errorf("OpenSSH 7.4 should not support %s", name)
+		}
+	}
+	if !contains(kex, "curve25519-sha256") {
+		t.Errorf("OpenSSH 7.4 should support curve25519-sha256")
+	}
+	if !contains(Dialect{9, 9}.SupportedAlgorithms("HostKeyAlgorithms"), "ssh-dss") {
+		t.Errorf("OpenSSH 9.9 should support ssh-dss")
+	}
+	if contains(SupportedAlgorithms("HostKeyAlgorithms"), "ssh-dss") {
+		t.Errorf("OpenSSH %v should not support ssh-dss", LatestDialect)
+	}
+
+	_, err := Dialect{7, 4}.ResolveAlgorithms("KexAlgorithms", "+mlkem768x25519-sha256")
+	if _, ok := err.(*UnknownAlgorithmError); !ok {
+		t.Errorf("ResolveAlgorithms on 7.4: got %v, want *UnknownAlgorithmError", err)
+	}
+	if _, err := (Dialect{7, 4}).ResolveAlgorithms("CASignatureAlgorithms", ""); err == nil {
+		t.Error("CASignatureAlgorithms should not be supported by OpenSSH 7.4")
+	}
+	got, err := Dialect{7, 4}.ResolveAlgorithms("Ciphers", "-*-cbc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"chacha20-poly1305@openssh.com", "aes128-ctr", "aes192-ctr", "aes256-ctr", "aes128-gcm@openssh.com", "aes256-gcm@openssh.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ResolveAlgorithms on 7.4:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestUserSettingsDialect(t *testing.T) {
+	u := &UserSettings{
+		userConfigFinder:   testConfigFinder("testdata/config1"),
+		systemConfigFinder: nullConfigFinder,
+		Dialect:            Dialect{7, 4},
+	}
+	if v := u.Get("wap", "CheckHostIP"); v != "yes" {
+		t.Errorf("Get CheckHostIP: got %q, want yes", v)
+	}
+	if v := u.Get("wap", "User"); v != "root" {
+		t.Errorf("Get User: got %q, want root", v)
+	}
+	r, err := u.Resolve("wap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := r.Get("Protocol"); v != "2" {
+		t.Errorf("Resolve Protocol: got %q, want 2", v)
+	}
+	// PubkeyAcceptedAlgorithms is the current name for PubkeyAcceptedKeyTypes,
+	// so both names return the 7.4 default.
+	for _, key := range []string{"PubkeyAcceptedKeyTypes", "PubkeyAcceptedAlgorithms"} {
+		if v := r.Get(key); v != pkAlg74 {
+			t.Errorf("Resolve %s: got %q, want %q", key, v, pkAlg74)
+		}
+	}
+	ciphers, err := r.GetAlgorithms("Ciphers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contains(ciphers, "aes256-cbc") {
+		t.Errorf("GetAlgorithms(Ciphers): got %q, want CBC ciphers", ciphers)
+	}
+
+	u.Dialect = Dialect{}
+	if v := u.Get("wap", "CheckHostIP"); v != "no" {
+		t.Errorf("latest: Get CheckHostIP: got %q, want no", v)
+	}
+}
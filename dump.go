@@ -0,0 +1,286 @@
+package ssh_config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// dumpFlags are the flag options printed by "ssh -G", in order. ssh prints
+// flags in lowercase, regardless of how they were spelled in the config file.
+var dumpFlags = []string{
+	"addressfamily",
+	"batchmode",
+	"canonicalizefallbacklocal",
+	"canonicalizehostname",
+	"checkhostip",
+	"compression",
+	"controlmaster",
+	"enablesshkeysign",
+	"clearallforwardings",
+	"exitonforwardfailure",
+	"fingerprinthash",
+	"forwardx11",
+	"forwardx11trusted",
+	"gatewayports",
+	"gssapiauthentication",
+	"gssapidelegatecredentials",
+	"hashknownhosts",
+	"hostbasedauthentication",
+	"identitiesonly",
+	"kbdinteractiveauthentication",
+	"nohostauthenticationforlocalhost",
+	"passwordauthentication",
+	"permitlocalcommand",
+	"proxyusefdpass",
+	"pubkeyauthentication",
+	"requesttty",
+	"sessiontype",
+	"stdinnull",
+	"forkafterauthentication",
+	"streamlocalbindunlink",
+	"stricthostkeychecking",
+	"tcpkeepalive",
+	"tunnel",
+	"verifyhostkeydns",
+	"visualhostkey",
+	"updatehostkeys",
+	"enableescapecommandline",
+}
+
+// dumpOrder lists keywords in the order that "ssh -G" prints them. The order
+// is taken from dump_client_config() in readconf.c:
+//
+//	https://github.com/openssh/openssh-portable/blob/master/readconf.c
+//
+// "host", "user", "hostname" and "port" are printed first and are handled
+// separately.
+var dumpOrder = append(append([]string{}, dumpFlags...),
+	// Integer options
+	"canonicalizemaxdots",
+	"connectionattempts",
+	"forwardx11timeout",
+	"numberofpasswordprompts",
+	"serveralivecountmax",
+	"serveraliveinterval",
+	"requiredrsasize",
+	"obscurekeystroketiming",
+
+	// String options
+	"bindaddress",
+	"bindinterface",
+	"ciphers",
+	"controlpath",
+	"hostkeyalgorithms",
+	"hostkeyalias",
+	"hostbasedacceptedalgorithms",
+	"identityagent",
+	"ignoreunknown",
+	"kbdinteractivedevices",
+	"kexalgorithms",
+	"casignaturealgorithms",
+	"localcommand",
+	"remotecommand",
+	"loglevel",
+	"macs",
+	"pkcs11provider",
+	"securitykeyprovider",
+	"preferredauthentications",
+	"pubkeyacceptedalgorithms",
+	"revokedhostkeys",
+	"xauthlocation",
+	"knownhostscommand",
+	"tag",
+
+	// Forwards
+	"dynamicforward",
+	"localforward",
+	"remoteforward",
+
+	// String array options
+	"identityfile",
+	"canonicaldomains",
+	"certificatefile",
+	"globalknownhostsfile",
+	"userknownhostsfile",
+	"sendenv",
+	"setenv",
+	"logverbose",
+	"channeltimeout",
+	"permitremoteopen",
+
+	// Special cases
+	"addkeystoagent",
+	"canonicalizepermittedcnames",
+	"connecttimeout",
+	"controlpersist",
+	"escapechar",
+	"forwardagent",
+	"ipqos",
+	"rekeylimit",
+	"streamlocalbindmask",
+	"proxycommand",
+	"proxyjump",
+	"tunneldevice",
+)
+
+var isDumpFlag = make(map[string]bool, len(dumpFlags))
+
+// dumpTimes are printed by "ssh -G" as a number of seconds.
+var dumpTimes = map[string]bool{
+	"connecttimeout":      true,
+	"forwardx11timeout":   true,
+	"serveraliveinterval": true,
+}
+
+// dumpSplit holds keywords that may list several values on one line in a
+// config file, but that "ssh -G" prints one value per line.
+var dumpSplit = map[string]bool{
+	"sendenv": true,
+	"setenv":  true,
+}
+
+func init() {
+	for _, key := range dumpFlags {
+		isDumpFlag[key] = true
+	}
+}
+
+// String returns r in the format printed by "ssh -G". See MarshalText.
+func (r *ResolvedHost) String() string {
+	b, _ := r.MarshalText()
+	return string(b)
+}
+
+// MarshalText encodes r in the format printed by "ssh -G": one lowercased
+// keyword and value per line, in the same order that ssh prints them.
+//
+// Keywords that were not set are filled in from their default value, so the
+// result of Config.Resolve and UserSettings.Resolve print the same way. As in
+// ssh, the user is always printed: if no User was set, it is r.LocalUser, or
+// the current user if r.LocalUser is empty. Keywords that ssh does not know
+// about are printed last, in the order they were found.
+func (r *ResolvedHost) MarshalText() ([]byte, error) {
+	vals := make(map[string][]string, len(r.keys))
+	order := make([]string, 0, len(r.keys))
+	for _, key := range r.keys {
+		ckey := canonicalKey(key)
+		if _, ok := vals[ckey]; !ok {
+			order = append(order, ckey)
+		} else if !SupportsMultiple(ckey) {
+			continue
+		}
+		// Use the values as set, not GetAll, since ssh prints path lists
+		// such as UserKnownHostsFile on one line.
+		for _, v := range r.values[key] {
+			vals[ckey] = append(vals[ckey], v.value)
+		}
+	}
+	for key, def := range r.dialect.defaults() {
+		ckey := canonicalKey(key)
+		if _, ok := vals[ckey]; !ok {
+			vals[ckey] = []string{def}
+		}
+	}
+	if _, ok := vals["identityfile"]; !ok {
+		vals["identityfile"] = r.dialect.DefaultAll("IdentityFile")
+	}
+
+	var buf bytes.Buffer
+	writeLine := func(key, val string) {
+		buf.WriteString(key)
+		buf.WriteByte(' ')
+		buf.WriteString(val)
+		buf.WriteByte('\n')
+	}
+	writeLine("host", r.Alias)
+	user := r.User()
+	if user == "" {
+		user = r.LocalUser
+	}
+	if user == "" {
+		user = localTokens().LocalUser
+	}
+	writeLine("user", user)
+	writeLine("hostname", strings.ToLower(r.HostName()))
+	if port := r.Get("Port"); port != "" {
+		writeLine("port", port)
+	} else {
+		writeLine("port", Default("Port"))
+	}
+	seen := map[string]bool{
+		"host":     true,
+		"user":     true,
+		"hostname": true,
+		"port":     true,
+	}
+	write := func(key string) error {
+		seen[key] = true
+		for _, val := range vals[key] {
+			if isDumpFlag[key] {
+				val = strings.ToLower(val)
+			}
+			if dumpTimes[key] {
+				secs, err := parseTime(val)
+				if err != nil {
+					return fmt.Errorf("ssh_config: invalid %s %q: %v", key, val, err)
+				}
+				val = strconv.FormatInt(secs, 10)
+			}
+			if dumpSplit[key] {
+				for _, field := range strings.Fields(val) {
+					writeLine(key, field)
+				}
+				continue
+			}
+			writeLine(key, val)
+		}
+		return nil
+	}
+	for _, key := range dumpOrder {
+		if err := write(key); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range order {
+		if seen[key] {
+			continue
+		}
+		if err := write(key); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeResolved reads the output of "ssh -G" into a ResolvedHost, so it can
+// be compared with the result of Resolve without invoking ssh.
+func DecodeResolved(rd io.Reader) (*ResolvedHost, error) {
+	r := newResolvedHost("")
+	scanner := bufio.NewScanner(rd)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		idx := strings.IndexByte(text, ' ')
+		if idx <= 0 {
+			return nil, fmt.Errorf("ssh_config: line %d: expected keyword and value, got %q", line, text)
+		}
+		key, val := text[:idx], text[idx+1:]
+		if key == "host" {
+			r.Alias = val
+			continue
+		}
+		r.set(key, val, nil, 0)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
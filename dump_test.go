@@ -0,0 +1,126 @@
+package ssh_config
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolvedHostMarshalText(t *testing.T) {
+	cfg, err := Decode(bytes.NewReader(loadFile(t, "testdata/dump-config")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The config sets no User, so ssh prints the local user.
+	ctx := NewMatchContext("db")
+	ctx.LocalUser = "kevin"
+	r, err := cfg.ResolveContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := loadFile(t, "testdata/dump-config.golden")
+	if !bytes.Equal(got, want) {
+		t.Errorf("MarshalText mismatch:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestResolvedHostMarshalDefaultIdentityFiles(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Host example\n    User root\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.Resolve("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, line := range strings.Split(r.String(), "\n") {
+		if strings.HasPrefix(line, "user ") && line != "user root" {
+			t.Errorf("got %q, want user root", line)
+		}
+		if strings.HasPrefix(line, "identityfile ") {
+			got = append(got, strings.TrimPrefix(line, "identityfile "))
+		}
+	}
+	if !reflect.DeepEqual(got, defaultIdentityFiles) {
+		t.Errorf("identityfile lines: got %q, want %q", got, defaultIdentityFiles)
+	}
+}
+
+func TestDecodeResolved(t *testing.T) {
+	golden := loadFile(t, "testdata/dump-config.golden")
+	r, err := DecodeResolved(bytes.NewReader(golden))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Alias != "db" {
+		t.Errorf("Alias: got %q, want db", r.Alias)
+	}
+	if got := r.HostName(); got != "db.internal.example.com" {
+		t.Errorf("HostName(): got %q", got)
+	}
+	if got := r.GetAll("SendEnv"); !reflect.DeepEqual(got, []string{"LANG", "LC_*"}) {
+		t.Errorf("GetAll(SendEnv): got %q", got)
+	}
+	out, err := r.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, golden) {
+		t.Errorf("round-trip mismatch:\ngot:\n%s\nwant:\n%s", out, golden)
+	}
+}
+
+func TestDecodeResolvedInvalid(t *testing.T) {
+	_, err := DecodeResolved(strings.NewReader("host db\nnovalue\n"))
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected line number in error, got %v", err)
+	}
+}
+
+var parseTimeTests = []struct {
+	in   string
+	want int64
+	err  bool
+}{
+	{"0", 0, false},
+	{"600", 600, false},
+	{"10m", 600, false},
+	{"1h30m", 5400, false},
+	{"1w", 604800, false},
+	{"2D", 172800, false},
+	{"", 0, true},
+	{"m", 0, true},
+	{"10x", 0, true},
+	{"2147483647", 2147483647, false},
+	{"2147483648", 0, true},
+	{"99999999999999999999999", 0, true},
+	{"100000w", 0, true},
+	{"2147483647s1", 0, true},
+}
+
+func TestParseTime(t *testing.T) {
+	for _, tt := range parseTimeTests {
+		got, err := parseTime(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseTime(%q): expected error, got nil", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTime(%q): %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("parseTime(%q): got %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package ssh_config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultIndent is the indentation for new keywords in a Host block, if there
+// is no existing keyword to copy it from.
+const defaultIndent = 4
+
+// unquotedKeywords take the rest of the line, or several whitespace-separated
+// arguments, so values for them are never quoted.
+var unquotedKeywords = map[string]bool{
+	strings.ToLower("CanonicalDomains"):            true,
+	strings.ToLower("CanonicalizePermittedCNAMEs"): true,
+	strings.ToLower("ChannelTimeout"):              true,
+	strings.ToLower("DynamicForward"):              true,
+	strings.ToLower("GlobalKnownHostsFile"):        true,
+	strings.ToLower("KnownHostsCommand"):           true,
+	strings.ToLower("LocalCommand"):                true,
+	strings.ToLower("LocalForward"):                true,
+	strings.ToLower("PermitRemoteOpen"):            true,
+	strings.ToLower("ProxyCommand"):                true,
+	strings.ToLower("RemoteCommand"):               true,
+	strings.ToLower("RemoteForward"):               true,
+	strings.ToLower("SendEnv"):                     true,
+	strings.ToLower("SetEnv"):                      true,
+	strings.ToLower("UserKnownHostsFile"):          true,
+}
+
+// quoteValue returns value as it should be written in a config file for key,
+// surrounded by double quotes if it is empty or contains whitespace.
+func quoteValue(key, value string) (string, error) {
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("ssh_config: value for %s cannot contain a newline", key)
+	}
+	if strings.ContainsRune(value, '#') {
+		return "", fmt.Errorf("ssh_config: value for %s cannot contain '#'", key)
+	}
+	if unquotedKeywords[strings.ToLower(key)] && value != "" && strings.TrimSpace(value) == value {
+		return value, nil
+	}
+	if value != "" && !strings.ContainsAny(value, " \t") {
+		return value, nil
+	}
+	if strings.ContainsRune(value, '"') {
+		return "", fmt.Errorf("ssh_config: value for %s cannot contain both whitespace and '\"'", key)
+	}
+	return `"` + value + `"`, nil
+}
+
+func validKey(key string) error {
+	if key == "" || strings.ContainsAny(key, " \t\r\n=#\"") {
+		return fmt.Errorf("ssh_config: invalid keyword %q", key)
+	}
+	switch strings.ToLower(key) {
+	case "host", "match", "include":
+		return fmt.Errorf("ssh_config: cannot set %s with Set or Add", key)
+	}
+	return nil
+}
+
+// SetValue sets the value for k, adding double quotes if the value needs them.
+// The key, comment and whitespace around the value are kept. SetValue returns
+// an error if value cannot be written to a config file, for example because it
+// contains a newline or a '#'.
+func (k *KV) SetValue(value string) error {
+	raw, err := quoteValue(k.Key, value)
+	if err != nil {
+		return err
+	}
+	k.Value = value
+	k.rawValue = raw
+	return nil
+}
+
+// findHost returns the first Host block whose patterns are exactly
+// hostPattern, e.g. "*.example.com !bastion.example.com". Match blocks are
+// never returned. If there is no "Host *" block, "*" refers to the options at
+// the top of the file, before the first Host or Match line.
+func (c *Config) findHost(hostPattern string) *Host {
+	if host := c.findHostLine(hostPattern); host != nil {
+		return host
+	}
+	if strings.TrimSpace(hostPattern) == "*" && len(c.Hosts) > 0 && c.Hosts[0].implicit {
+		return c.Hosts[0]
+	}
+	return nil
+}
+
+// findHostLine returns the first Host block whose patterns are exactly
+// hostPattern.
+func (c *Config) findHostLine(hostPattern string) *Host {
+	want := strings.Fields(hostPattern)
+	if len(want) == 0 {
+		return nil
+	}
+	for _, host := range c.Hosts {
+		if host.isMatch || host.implicit || len(host.Patterns) != len(want) {
+			continue
+		}
+		found := true
+		for i, pat := range host.Patterns {
+			if pat.String() != want[i] {
+				found = false
+				break
+			}
+		}
+		if found {
+			return host
+		}
+	}
+	return nil
+}
+
+func (c *Config) mustFindHost(hostPattern string) (*Host, error) {
+	host := c.findHost(hostPattern)
+	if host == nil {
+		return nil, fmt.Errorf("ssh_config: no Host block for %q", hostPattern)
+	}
+	return host, nil
+}
+
+// newKV returns a KV for key and value that is indented and uses "=" in the
+// same way as the other keywords in host, or failing that in c.
+func (c *Config) newKV(host *Host, key, value string) (*KV, error) {
+	indent, equals := defaultIndent, false
+	if host.implicit {
+		indent = 0
+	}
+	if neighbour := lastKV(host); neighbour != nil {
+		indent, equals = neighbour.leadingSpace, neighbour.hasEquals
+	} else if !host.implicit {
+		for _, h := range c.Hosts {
+			if h.implicit {
+				continue
+			}
+			if neighbour := lastKV(h); neighbour != nil {
+				indent, equals = neighbour.leadingSpace, neighbour.hasEquals
+				break
+			}
+		}
+	}
+	opts := []NodeOption{WithIndent(indent)}
+	if equals {
+		opts = append(opts, WithEquals())
+	}
+	return NewKV(key, value, opts...)
+}
+
+func lastKV(host *Host) *KV {
+	for i := len(host.Nodes) - 1; i >= 0; i-- {
+		if kv, ok := host.Nodes[i].(*KV); ok {
+			return kv
+		}
+	}
+	return nil
+}
+
+// appendNode adds node after the last keyword or Include in host, so that any
+// blank lines or comments at the end of the block stay between it and the
+// next block.
+func appendNode(host *Host, node Node) {
+	i := len(host.Nodes)
+	for i > 0 {
+		if _, ok := host.Nodes[i-1].(*Empty); !ok {
+			break
+		}
+		i--
+	}
+	host.Nodes = append(host.Nodes, nil)
+	copy(host.Nodes[i+1:], host.Nodes[i:])
+	host.Nodes[i] = node
+}
+
+// Set sets key to value in the Host block whose patterns are exactly
+// hostPattern. If the block already contains key, the first occurrence is
+// updated in place, keeping its comment and formatting, and any later
+// occurrences in the block are removed. Otherwise a new line is added at the
+// end of the block, indented like the lines around it. Values that contain
+// whitespace are quoted.
+//
+// Set returns an error if there is no Host block for hostPattern; use AddHost
+// to create one.
+func (c *Config) Set(hostPattern, key, value string) error {
+	host, err := c.mustFindHost(hostPattern)
+	if err != nil {
+		return err
+	}
+	lkey := strings.ToLower(key)
+	var found *KV
+	for _, node := range host.Nodes {
+		if kv, ok := node.(*KV); ok && strings.ToLower(kv.Key) == lkey {
+			found = kv
+			break
+		}
+	}
+	if found == nil {
+		return c.Add(hostPattern, key, value)
+	}
+	if err := found.SetValue(value); err != nil {
+		return err
+	}
+	nodes := host.Nodes[:0]
+	for _, node := range host.Nodes {
+		if kv, ok := node.(*KV); ok && kv != found && strings.ToLower(kv.Key) == lkey {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	host.Nodes = nodes
+	return nil
+}
+
+// Add adds a new line for key and value at the end of the Host block whose
+// patterns are exactly hostPattern, even if the block already contains key.
+// Use Add for keywords that may be specified multiple times, such as
+// IdentityFile or LocalForward.
+func (c *Config) Add(hostPattern, key, value string) error {
+	host, err := c.mustFindHost(hostPattern)
+	if err != nil {
+		return err
+	}
+	kv, err := c.newKV(host, key, value)
+	if err != nil {
+		return err
+	}
+	appendNode(host, kv)
+	return nil
+}
+
+// Delete removes every line for key from the Host block whose patterns are
+// exactly hostPattern. Delete reports whether any lines were removed.
+func (c *Config) Delete(hostPattern, key string) (bool, error) {
+	host, err := c.mustFindHost(hostPattern)
+	if err != nil {
+		return false, err
+	}
+	lkey := strings.ToLower(key)
+	removed := false
+	nodes := host.Nodes[:0]
+	for _, node := range host.Nodes {
+		if kv, ok := node.(*KV); ok && strings.ToLower(kv.Key) == lkey {
+			removed = true
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	host.Nodes = nodes
+	return removed, nil
+}
+
+// AddHost adds a new, empty Host block for patterns and returns it. Since the
+// first value that ssh finds for a keyword wins, the block is added before the
+// first "Host *" block, if there is one, and at the end of the file otherwise.
+// A blank line separates the new block from its neighbours.
+func (c *Config) AddHost(patterns ...string) (*Host, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("ssh_config: AddHost requires at least one pattern")
+	}
+	host, err := NewHost(patterns...)
+	if err != nil {
+		return nil, err
+	}
+	if c.findHostLine(strings.Join(patterns, " ")) != nil {
+		return nil, fmt.Errorf("ssh_config: Host %s already exists", strings.Join(patterns, " "))
+	}
+	for _, h := range c.Hosts {
+		if !h.implicit && !h.isMatch {
+			host.hasEquals = h.hasEquals
+			break
+		}
+	}
+	idx := len(c.Hosts)
+	for i, h := range c.Hosts {
+		if !h.implicit && !h.isMatch && len(h.Patterns) == 1 && h.Patterns[0].String() == "*" {
+			idx = i
+			break
+		}
+	}
+	if idx > 0 {
+		prev := c.Hosts[idx-1]
+		if idx < len(c.Hosts) {
+			// Comments directly above the next Host line describe that
+			// block, so keep them with it.
+			comments := trailingComments(prev)
+			prev.Nodes = prev.Nodes[:len(prev.Nodes)-len(comments)]
+			host.Nodes = append(host.Nodes, &Empty{})
+			host.Nodes = append(host.Nodes, comments...)
+		}
+		if n := len(prev.Nodes); n > 0 {
+			if e, ok := prev.Nodes[n-1].(*Empty); !ok || e.Comment != "" {
+				prev.Nodes = append(prev.Nodes, &Empty{})
+			}
+		}
+	}
+	c.Hosts = append(c.Hosts, nil)
+	copy(c.Hosts[idx+1:], c.Hosts[idx:])
+	c.Hosts[idx] = host
+	return host, nil
+}
+
+// trailingComments returns the comment lines at the end of host that are not
+// separated from the next block by a blank line.
+func trailingComments(host *Host) []Node {
+	i := len(host.Nodes)
+	for i > 0 {
+		e, ok := host.Nodes[i-1].(*Empty)
+		if !ok || e.Comment == "" {
+			break
+		}
+		i--
+	}
+	comments := make([]Node, len(host.Nodes)-i)
+	copy(comments, host.Nodes[i:])
+	return comments
+}
+
+// RemoveHost removes the Host block whose patterns are exactly hostPattern,
+// along with every line in it.
+func (c *Config) RemoveHost(hostPattern string) error {
+	host, err := c.mustFindHost(hostPattern)
+	if err != nil {
+		return err
+	}
+	if host.implicit {
+		return fmt.Errorf("ssh_config: cannot remove the options at the top of the file")
+	}
+	for i := range c.Hosts {
+		if c.Hosts[i] == host {
+			c.Hosts = append(c.Hosts[:i], c.Hosts[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// SetPatterns replaces the patterns on a Host line, e.g. to rename a host.
+// The comment at the end of the line is kept. SetPatterns returns an error for
+// a Match block, or if a pattern is invalid.
+func (h *Host) SetPatterns(patterns ...string) error {
+	if h.isMatch {
+		return fmt.Errorf("ssh_config: cannot set patterns on a Match block")
+	}
+	if h.implicit {
+		return fmt.Errorf("ssh_config: cannot set patterns on the options at the top of the file")
+	}
+	if len(patterns) == 0 {
+		return fmt.Errorf("ssh_config: Host requires at least one pattern")
+	}
+	pats := make([]*Pattern, 0, len(patterns))
+	for _, s := range patterns {
+		if strings.ContainsAny(s, " \t\r\n#\"") {
+			return fmt.Errorf("ssh_config: invalid host pattern %q", s)
+		}
+		pat, err := NewPattern(s)
+		if err != nil {
+			return err
+		}
+		pats = append(pats, pat)
+	}
+	h.Patterns = pats
+	return nil
+}
@@ -0,0 +1,244 @@
+package ssh_config
+
+import (
+	"strings"
+	"testing"
+)
+
+const editConfig = `# Global options
+Compression yes
+
+Host web # the web server
+  HostName = web.example.com
+  User = deploy   # not root
+
+Host db
+  HostName = db.example.com
+  IdentityFile = ~/.ssh/db
+  IdentityFile = ~/.ssh/backup
+
+# Defaults for everything else.
+Host *
+  ServerAliveInterval = 60
+`
+
+func decodeEdit(t *testing.T) *Config {
+	t.Helper()
+	cfg, err := Decode(strings.NewReader(editConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestConfigSet(t *testing.T) {
+	cfg := decodeEdit(t)
+	if err := cfg.Set("web", "User", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Set("web", "Port", "2222"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Set("db", "identityfile", "~/My Keys/db"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Set("*", "ForwardAgent", "no"); err != nil {
+		t.Fatal(err)
+	}
+	want := `# Global options
+Compression yes
+
+Host web # the web server
+  HostName = web.example.com
+  User = admin   # not root
+  Port = 2222
+
+Host db
+  HostName = db.example.com
+  IdentityFile = "~/My Keys/db"
+
+# Defaults for everything else.
+Host *
+  ServerAliveInterval = 60
+  ForwardAgent = no
+`
+	if got := cfg.String(); got != want {
+		t.Errorf("Set: got\n%s\nwant\n%s", got, want)
+	}
+	if val, _ := cfg.Get("db", "IdentityFile"); val != "~/My Keys/db" {
+		t.Errorf("Get(IdentityFile): got %q", val)
+	}
+}
+
+func TestConfigSetErrors(t *testing.T) {
+	cfg := decodeEdit(t)
+	tests := []struct {
+		host, key, value string
+		err              string
+	}{
+		{"nope", "User", "x", `ssh_config: no Host block for "nope"`},
+		{"web", "User", "a\nb", "ssh_config: value for User cannot contain a newline"},
+		{"web", "User", "a#b", "ssh_config: value for User cannot contain '#'"},
+		{"web", "ProxyCommand", `sh -c "nc %h %p"`, ""},
+		{"web", "IdentityFile", `"a b"`, `ssh_config: value for IdentityFile cannot contain both whitespace and '"'`},
+		{"web", "Bad Key", "x", `ssh_config: invalid keyword "Bad Key"`},
+		{"web", "Host", "x", "ssh_config: cannot set Host with Set or Add"},
+	}
+	for _, tt := range tests {
+		err := cfg.Set(tt.host, tt.key, tt.value)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("Set(%q, %q, %q): %v", tt.host, tt.key, tt.value, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("Set(%q, %q, %q): got err %v, want %q", tt.host, tt.key, tt.value, err, tt.err)
+		}
+	}
+	if val, _ := cfg.Get("web", "User"); val != "deploy" {
+		t.Errorf("failed Set changed User to %q", val)
+	}
+}
+
+func TestConfigAddDelete(t *testing.T) {
+	cfg := decodeEdit(t)
+	if err := cfg.Add("db", "IdentityFile", "~/.ssh/third"); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := cfg.Delete("web", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !removed {
+		t.Error("expected Delete to remove User")
+	}
+	removed, err = cfg.Delete("web", "Port")
+	if err != nil || removed {
+		t.Errorf("Delete(Port): got %t, %v", removed, err)
+	}
+	if err := cfg.Add("*", "SendEnv", "LANG LC_*"); err != nil {
+		t.Fatal(err)
+	}
+	want := `# Global options
+Compression yes
+
+Host web # the web server
+  HostName = web.example.com
+
+Host db
+  HostName = db.example.com
+  IdentityFile = ~/.ssh/db
+  IdentityFile = ~/.ssh/backup
+  IdentityFile = ~/.ssh/third
+
+# Defaults for everything else.
+Host *
+  ServerAliveInterval = 60
+  SendEnv = LANG LC_*
+`
+	if got := cfg.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestConfigAddHost(t *testing.T) {
+	cfg := decodeEdit(t)
+	host, err := cfg.AddHost("bastion", "bastion.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host.EOLComment = " added by onboarding"
+	if err := cfg.Set("bastion bastion.example.com", "HostName", "203.0.113.10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Set("bastion bastion.example.com", "User", "kevin"); err != nil {
+		t.Fatal(err)
+	}
+	want := `# Global options
+Compression yes
+
+Host web # the web server
+  HostName = web.example.com
+  User = deploy   # not root
+
+Host db
+  HostName = db.example.com
+  IdentityFile = ~/.ssh/db
+  IdentityFile = ~/.ssh/backup
+
+Host bastion bastion.example.com # added by onboarding
+  HostName = 203.0.113.10
+  User = kevin
+
+# Defaults for everything else.
+Host *
+  ServerAliveInterval = 60
+`
+	if got := cfg.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if _, err := cfg.AddHost("db"); err == nil || err.Error() != "ssh_config: Host db already exists" {
+		t.Errorf("AddHost(db): got err %v", err)
+	}
+}
+
+func TestConfigAddHostEmptyFile(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("User kevin\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.AddHost("bastion"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Set("bastion", "Port", "2200"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Set("*", "Compression", "yes"); err != nil {
+		t.Fatal(err)
+	}
+	want := "User kevin\nCompression yes\n\nHost bastion\n    Port 2200\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestConfigRemoveHost(t *testing.T) {
+	cfg := decodeEdit(t)
+	if err := cfg.RemoveHost("web"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.RemoveHost("web"); err == nil {
+		t.Error("expected error removing web twice")
+	}
+	if val, _ := cfg.Get("web", "User"); val != "" {
+		t.Errorf("Get(web, User) after RemoveHost: got %q", val)
+	}
+	if strings.Contains(cfg.String(), "web.example.com") {
+		t.Errorf("RemoveHost left lines behind:\n%s", cfg.String())
+	}
+}
+
+func TestHostSetPatterns(t *testing.T) {
+	cfg := decodeEdit(t)
+	host := cfg.findHost("web")
+	if err := host.SetPatterns("www", "www.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(cfg.String(), "Host www www.example.com # the web server\n") {
+		t.Errorf("SetPatterns did not rename host:\n%s", cfg.String())
+	}
+	if val, _ := cfg.Get("www.example.com", "User"); val != "deploy" {
+		t.Errorf("Get after SetPatterns: got %q", val)
+	}
+	if err := host.SetPatterns("bad pattern"); err == nil {
+		t.Error("expected error for pattern with a space")
+	}
+	match, err := Decode(strings.NewReader("Match user root\n  Port 22\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := match.Hosts[1].SetPatterns("x"); err == nil {
+		t.Error("expected error setting patterns on a Match block")
+	}
+}
@@ -0,0 +1,164 @@
+package ssh_config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrUnsupportedMatch is wrapped by the error for a Match directive with
+	// a criterion that this package does not recognize.
+	ErrUnsupportedMatch = errors.New("ssh_config: unsupported Match criterion")
+	// ErrInvalidPattern is wrapped by the error for a host or Match pattern
+	// that cannot be parsed.
+	ErrInvalidPattern = errors.New("ssh_config: invalid pattern")
+	// ErrIncludeGlob is wrapped by the error for an Include directive whose
+	// file glob is malformed.
+	ErrIncludeGlob = errors.New("ssh_config: invalid Include glob")
+)
+
+// ParseError describes a problem with a line in a config file. Decode,
+// DecodeBytes and the functions that read config files from disk return a
+// *ParseError if a file cannot be parsed; use errors.As to retrieve it, and
+// errors.Is to check for ErrUnsupportedMatch, ErrInvalidPattern,
+// ErrDepthExceeded or ErrIncludeGlob.
+type ParseError struct {
+	// File is the path of the file that contains the error, or the empty
+	// string if the Config was read with Decode or DecodeBytes.
+	File string
+	// Pos is the position of the error in File.
+	Pos Position
+	// Msg describes the error, without the file or position.
+	Msg string
+	// IncludeChain lists the files whose Include directives led to File,
+	// starting with the outermost file. It is empty if the error is not in
+	// an included file. The first entry is the empty string if the outermost
+	// Config was read with Decode or DecodeBytes.
+	IncludeChain []string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	var buf strings.Builder
+	if e.File != "" {
+		buf.WriteString(e.File)
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(e.Pos.String())
+	buf.WriteString(": ")
+	buf.WriteString(e.Msg)
+	if chain := nonEmpty(e.IncludeChain); len(chain) > 0 {
+		fmt.Fprintf(&buf, " (included from %s)", strings.Join(chain, " -> "))
+	}
+	return buf.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// setFile records that e was found while parsing filename: either in the file
+// itself, or in a file that it included.
+func (e *ParseError) setFile(filename string) {
+	if e.File == "" {
+		e.File = filename
+	} else if len(e.IncludeChain) > 0 && e.IncludeChain[0] == "" {
+		e.IncludeChain[0] = filename
+	}
+}
+
+// included returns a copy of e for an error in a file that was included by
+// the file being parsed. parseWithDepth fills in the name of that file.
+func (e *ParseError) included() *ParseError {
+	pe := *e
+	pe.IncludeChain = append([]string{""}, e.IncludeChain...)
+	return &pe
+}
+
+// ParseErrors is returned by DecodeWithOptions when Recover is set and one or
+// more lines could not be parsed.
+type ParseErrors []*ParseError
+
+// Error prints one error per line.
+func (e ParseErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i := range e {
+		msgs[i] = e[i].Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors in e, so that errors.Is and errors.As check each
+// of them in Go 1.20 and later.
+func (e ParseErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i := range e {
+		errs[i] = e[i]
+	}
+	return errs
+}
+
+// ValidationError describes a value that is not valid for its keyword, such
+// as "StrictHostKeyChecking maybe" or a LocalForward without a port.
+type ValidationError struct {
+	// File is the path of the file that contains the value, or the empty
+	// string if the Config was read with Decode or DecodeBytes, or if the
+	// value was not read from a file.
+	File string
+	// Pos is the position of the value in File. Pos is invalid if the value
+	// was not read from a file.
+	Pos Position
+	// Key and Value are the keyword and value, as they appear in the file.
+	Key   string
+	Value string
+	// Msg describes the problem, without the file or position.
+	Msg string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	var buf strings.Builder
+	if e.File != "" {
+		buf.WriteString(e.File)
+		buf.WriteByte(' ')
+	}
+	if !e.Pos.Invalid() {
+		buf.WriteString(e.Pos.String())
+		buf.WriteString(": ")
+	}
+	buf.WriteString("ssh_config: ")
+	buf.WriteString(e.Msg)
+	return buf.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors is returned by Config.Validate when one or more values are
+// not valid.
+type ValidationErrors []*ValidationError
+
+// Error prints one error per line.
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i := range e {
+		msgs[i] = e[i].Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors in e, so that errors.Is and errors.As check each
+// of them in Go 1.20 and later.
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i := range e {
+		errs[i] = e[i]
+	}
+	return errs
+}
@@ -0,0 +1,51 @@
+package ssh_config
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// Executor runs the command for a "Match exec" criterion.
+//
+// Running commands from a configuration file allows anyone who can write to
+// that file to run code on your machine, so commands are only run if an
+// Executor is set on the MatchContext or UserSettings.
+type Executor interface {
+	// Exec runs command, after percent tokens have been expanded, and reports
+	// whether it exited with status zero. Exec should return an error only
+	// if the command could not be run.
+	Exec(command string) (bool, error)
+}
+
+// ExecutorFunc is an adapter to allow the use of an ordinary function as an
+// Executor.
+type ExecutorFunc func(command string) (bool, error)
+
+// Exec calls f(command).
+func (f ExecutorFunc) Exec(command string) (bool, error) {
+	return f(command)
+}
+
+// ShellExecutor runs commands with the user's shell ($SHELL, or /bin/sh if it
+// is not set), the same way ssh does. Standard input and output are discarded
+// and standard error is passed through.
+var ShellExecutor Executor = ExecutorFunc(shellExec)
+
+func shellExec(command string) (bool, error) {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	cmd := exec.Command(shell, "-c", command)
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err == nil {
+		return true, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	return false, err
+}
@@ -0,0 +1,413 @@
+package ssh_config
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	osuser "os/user"
+	"strings"
+)
+
+// TokenContext holds the values that are substituted for percent tokens such as
+// "%h" and "%r". See the TOKENS section of the ssh_config manpage for a
+// description of each token.
+//
+// Nothing in a TokenContext is read from the environment, so expansion is
+// deterministic. Use LocalTokenContext to fill in the fields that describe the
+// local machine, and ResolvedHost.ExpandTokens to fill in the fields that
+// describe the remote host.
+type TokenContext struct {
+	// LocalUser is the local user name (%u).
+	LocalUser string
+	// UID is the local user ID (%i).
+	UID string
+	// HomeDir is the local user's home directory (%d).
+	HomeDir string
+	// LocalHostname is the local hostname, including the domain name (%l).
+	// The first component of the name is used for %L.
+	LocalHostname string
+	// JumpHost is the contents of the ProxyJump option (%j).
+	JumpHost string
+
+	// OriginalHost is the remote hostname, as given on the command line (%n).
+	OriginalHost string
+	// Host is the remote hostname, after any HostName substitution (%h).
+	Host string
+	// Port is the remote port (%p).
+	Port string
+	// RemoteUser is the remote user name (%r).
+	RemoteUser string
+	// HostKeyAlias is the host key alias (%k). If empty, OriginalHost is used.
+	HostKeyAlias string
+
+	// KnownHostsHost is the known_hosts hostname or address that is being
+	// searched for (%H).
+	KnownHostsHost string
+	// KnownHostsReason describes why KnownHostsCommand is being run (%I).
+	KnownHostsReason string
+	// HostKeyFingerprint is the fingerprint of the server's host key (%f).
+	HostKeyFingerprint string
+	// HostKey is the base64 encoded host key (%K).
+	HostKey string
+	// HostKeyType is the type of the server's host key (%t).
+	HostKeyType string
+	// TunnelDevice is the local tun/tap interface (%T). If empty, "NONE" is
+	// used.
+	TunnelDevice string
+}
+
+// LocalTokenContext returns a TokenContext with the fields that describe the
+// local machine filled in from the current user and hostname.
+func LocalTokenContext() (TokenContext, error) {
+	u, err := osuser.Current()
+	if err != nil {
+		return TokenContext{}, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return TokenContext{}, err
+	}
+	return TokenContext{
+		LocalUser:     u.Username,
+		UID:           u.Uid,
+		HomeDir:       u.HomeDir,
+		LocalHostname: hostname,
+	}, nil
+}
+
+// ConnectionHash returns the value of the %C token: a SHA1 hash of
+// %l%h%p%r%j, encoded as lowercase hex. This matches ssh_connection_hash() in
+// OpenSSH.
+func (tc *TokenContext) ConnectionHash() string {
+	h := sha1.New()
+	h.Write([]byte(tc.LocalHostname))
+	h.Write([]byte(tc.Host))
+	h.Write([]byte(tc.Port))
+	h.Write([]byte(tc.RemoteUser))
+	h.Write([]byte(tc.JumpHost))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// token returns the value for the token byte b.
+func (tc *TokenContext) token(b byte) string {
+	switch b {
+	case '%':
+		return "%"
+	case 'C':
+		return tc.ConnectionHash()
+	case 'd':
+		return tc.HomeDir
+	case 'f':
+		return tc.HostKeyFingerprint
+	case 'H':
+		return tc.KnownHostsHost
+	case 'h':
+		return tc.Host
+	case 'I':
+		return tc.KnownHostsReason
+	case 'i':
+		return tc.UID
+	case 'j':
+		return tc.JumpHost
+	case 'K':
+		return tc.HostKey
+	case 'k':
+		if tc.HostKeyAlias != "" {
+			return tc.HostKeyAlias
+		}
+		return tc.OriginalHost
+	case 'L':
+		if idx := strings.IndexByte(tc.LocalHostname, '.'); idx >= 0 {
+			return tc.LocalHostname[:idx]
+		}
+		return tc.LocalHostname
+	case 'l':
+		return tc.LocalHostname
+	case 'n':
+		return tc.OriginalHost
+	case 'p':
+		return tc.Port
+	case 'r':
+		return tc.RemoteUser
+	case 'T':
+		if tc.TunnelDevice == "" {
+			return "NONE"
+		}
+		return tc.TunnelDevice
+	case 't':
+		return tc.HostKeyType
+	case 'u':
+		return tc.LocalUser
+	}
+	panic(fmt.Sprintf("ssh_config: unknown token %%%c", b))
+}
+
+// allTokens lists every token that ssh knows about, except "%%".
+const allTokens = "CdfHhIijKkLlnprTtu"
+
+// defaultTokens are the tokens accepted by most keywords that allow tokens.
+const defaultTokens = "CdhijkLlnpru"
+
+// matchExecKeyword is the name used to look up the tokens allowed in the
+// command for a "Match exec" criterion.
+const matchExecKeyword = "match exec"
+
+// allowedTokens maps lowercased keywords to the tokens they accept, per the
+// TOKENS section of the ssh_config manpage. "%%" is accepted by every keyword
+// listed here.
+var allowedTokens = map[string]string{
+	strings.ToLower("CertificateFile"):    defaultTokens,
+	strings.ToLower("ControlPath"):        defaultTokens,
+	strings.ToLower("IdentityAgent"):      defaultTokens,
+	strings.ToLower("IdentityFile"):       defaultTokens,
+	strings.ToLower("KnownHostsCommand"):  defaultTokens + "fHIKt",
+	strings.ToLower("LocalForward"):       defaultTokens,
+	matchExecKeyword:                      defaultTokens,
+	strings.ToLower("RemoteCommand"):      defaultTokens,
+	strings.ToLower("RemoteForward"):      defaultTokens,
+	strings.ToLower("RevokedHostKeys"):    defaultTokens,
+	strings.ToLower("UserKnownHostsFile"): defaultTokens,
+
+	strings.ToLower("HostName"):     "h",
+	strings.ToLower("LocalCommand"): allTokens,
+	strings.ToLower("ProxyCommand"): "hnpr",
+	strings.ToLower("ProxyJump"):    "hnpr",
+}
+
+// SupportsTokens reports whether percent tokens are expanded in the value for
+// keyword.
+func SupportsTokens(keyword string) bool {
+	_, ok := allowedTokens[strings.ToLower(keyword)]
+	return ok
+}
+
+// TokenError is returned when a value contains a percent token that is not
+// allowed for its keyword, or that ssh does not know about.
+type TokenError struct {
+	Keyword string
+	// Token is the invalid token, including the leading "%". Token is "%" if
+	// the value ended with a single "%".
+	Token string
+}
+
+func (e *TokenError) Error() string {
+	if e.Token == "%" {
+		return fmt.Sprintf("ssh_config: %s value ends with an incomplete %% token", e.Keyword)
+	}
+	if !strings.Contains(allTokens, e.Token[1:]) {
+		return fmt.Sprintf("ssh_config: unknown token %s in %s", e.Token, e.Keyword)
+	}
+	return fmt.Sprintf("ssh_config: token %s is not allowed in %s", e.Token, e.Keyword)
+}
+
+// ExpandTokens replaces the percent tokens in value with the values in ctx. The
+// tokens that may appear in value depend on keyword; a *TokenError is
+// returned if value contains a token that keyword does not allow.
+//
+// If keyword does not support tokens at all, value is returned unchanged.
+func ExpandTokens(keyword, value string, ctx *TokenContext) (string, error) {
+	allowed, ok := allowedTokens[strings.ToLower(keyword)]
+	if !ok {
+		return value, nil
+	}
+	if ctx == nil {
+		ctx = &TokenContext{}
+	}
+	return expandValue(keyword, value, allowed, ctx, nil)
+}
+
+// ExpandTokens expands the percent tokens in every value for key. The fields
+// in ctx that describe the remote host are filled in from r if they are empty:
+// OriginalHost from the alias, Host from HostName, and Port, RemoteUser,
+// HostKeyAlias and JumpHost from Port, User, HostKeyAlias and ProxyJump. If
+// no User was set, the remote user is the local user.
+func (r *ResolvedHost) ExpandTokens(key string, ctx TokenContext) ([]string, error) {
+	fill := func(field *string, val string) {
+		if *field == "" {
+			*field = val
+		}
+	}
+	fill(&ctx.OriginalHost, r.Alias)
+	fill(&ctx.Host, r.HostName())
+	fill(&ctx.Port, r.Get("Port"))
+	fill(&ctx.Port, Default("Port"))
+	fill(&ctx.RemoteUser, r.User())
+	fill(&ctx.RemoteUser, ctx.LocalUser)
+	fill(&ctx.HostKeyAlias, r.Get("HostKeyAlias"))
+	fill(&ctx.JumpHost, r.Get("ProxyJump"))
+
+	vals := r.GetAll(key)
+	if vals == nil {
+		return nil, nil
+	}
+	expanded := make([]string, len(vals))
+	for i := range vals {
+		val, err := ExpandTokens(key, vals[i], &ctx)
+		if err != nil {
+			return nil, err
+		}
+		expanded[i] = val
+	}
+	return expanded, nil
+}
+
+// envKeywords are the lowercased keywords whose values may contain ${VAR}
+// references to environment variables.
+var envKeywords = map[string]bool{
+	strings.ToLower("CertificateFile"):    true,
+	strings.ToLower("ControlPath"):        true,
+	strings.ToLower("IdentityAgent"):      true,
+	strings.ToLower("IdentityFile"):       true,
+	strings.ToLower("KnownHostsCommand"):  true,
+	strings.ToLower("LocalForward"):       true,
+	strings.ToLower("RemoteForward"):      true,
+	strings.ToLower("UserKnownHostsFile"): true,
+}
+
+// SupportsEnv reports whether ${VAR} environment variable references are
+// expanded in the value for keyword.
+func SupportsEnv(keyword string) bool {
+	return envKeywords[strings.ToLower(keyword)]
+}
+
+// EnvError is returned when a value refers to an environment variable that is
+// not set, or contains a malformed ${VAR} reference.
+type EnvError struct {
+	Keyword string
+	// Name is the name of the environment variable. Name is empty if the
+	// reference was malformed.
+	Name string
+}
+
+func (e *EnvError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("ssh_config: unterminated or empty ${} variable in %s", e.Keyword)
+	}
+	return fmt.Sprintf("ssh_config: env var ${%s} has no value in %s", e.Name, e.Keyword)
+}
+
+// ExpandEnv replaces ${VAR} references in value with the result of calling
+// lookup with VAR. lookup has the same signature as os.LookupEnv, which is
+// the usual choice; tests can substitute their own function. As in ssh, an
+// *EnvError is returned if lookup reports that a variable is not set.
+//
+// Only ${VAR} references are expanded; a "$" that is not followed by "{" is
+// left alone. If keyword does not support environment variables, value is
+// returned unchanged.
+func ExpandEnv(keyword, value string, lookup func(string) (string, bool)) (string, error) {
+	if !SupportsEnv(keyword) || !strings.Contains(value, "${") {
+		return value, nil
+	}
+	return expandValue(keyword, value, "", nil, lookup)
+}
+
+// expandValue replaces the percent tokens in value with the values in ctx,
+// and ${VAR} references with the result of calling lookup. As in
+// percent_dollar_expand in OpenSSH's misc.c, both are replaced in a single
+// pass, so text that was substituted is never expanded again: a "%" in an
+// environment variable is kept as it is. If ctx is nil, percent tokens are
+// copied unchanged; otherwise allowed lists the tokens that keyword accepts.
+// If lookup is nil, ${VAR} references are copied unchanged.
+func expandValue(keyword, value, allowed string, ctx *TokenContext, lookup func(string) (string, bool)) (string, error) {
+	var buf strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case lookup != nil && value[i] == '$' && i+1 < len(value) && value[i+1] == '{':
+			end := strings.IndexByte(value[i+2:], '}')
+			if end <= 0 {
+				return "", &EnvError{Keyword: keyword}
+			}
+			name := value[i+2 : i+2+end]
+			val, ok := lookup(name)
+			if !ok {
+				return "", &EnvError{Keyword: keyword, Name: name}
+			}
+			buf.WriteString(val)
+			i += end + 2
+		case ctx != nil && value[i] == '%':
+			if i == len(value)-1 {
+				return "", &TokenError{Keyword: keyword, Token: "%"}
+			}
+			i++
+			b := value[i]
+			if b != '%' && strings.IndexByte(allowed, b) < 0 {
+				return "", &TokenError{Keyword: keyword, Token: "%" + string(b)}
+			}
+			buf.WriteString(ctx.token(b))
+		default:
+			buf.WriteByte(value[i])
+		}
+	}
+	return buf.String(), nil
+}
+
+// tildeKeywords are the lowercased keywords whose values are paths that may
+// begin with "~".
+var tildeKeywords = map[string]bool{
+	strings.ToLower("CertificateFile"):    true,
+	strings.ToLower("ControlPath"):        true,
+	strings.ToLower("IdentityAgent"):      true,
+	strings.ToLower("IdentityFile"):       true,
+	strings.ToLower("RevokedHostKeys"):    true,
+	strings.ToLower("UserKnownHostsFile"): true,
+}
+
+// ExpandTilde replaces a leading "~" or "~/" in path with home. Other uses of
+// "~", including "~user/", are left alone.
+func ExpandTilde(path, home string) string {
+	if path == "~" {
+		return home
+	}
+	if strings.HasPrefix(path, "~/") {
+		return strings.TrimSuffix(home, "/") + path[1:]
+	}
+	return path
+}
+
+// Expander expands a value the same way ssh does before using it: a leading
+// "~" is replaced with the home directory, then ${VAR} references and percent
+// tokens are replaced in a single pass. Each step only applies to the keywords
+// that support it.
+type Expander struct {
+	// Tokens holds the values for percent tokens. Tokens.HomeDir is also
+	// used for tilde expansion.
+	Tokens TokenContext
+	// LookupEnv looks up environment variables, and is usually os.LookupEnv.
+	// If LookupEnv is nil, ${VAR} references are not expanded.
+	LookupEnv func(string) (string, bool)
+}
+
+// Expand expands value, which was set for keyword. UserKnownHostsFile may
+// contain several paths, and each of them is expanded separately.
+func (e *Expander) Expand(keyword, value string) (string, error) {
+	if strings.EqualFold(keyword, "UserKnownHostsFile") {
+		fields := strings.Fields(value)
+		for i := range fields {
+			val, err := e.expand(keyword, fields[i])
+			if err != nil {
+				return "", err
+			}
+			fields[i] = val
+		}
+		return strings.Join(fields, " "), nil
+	}
+	return e.expand(keyword, value)
+}
+
+func (e *Expander) expand(keyword, value string) (string, error) {
+	lkey := strings.ToLower(keyword)
+	if tildeKeywords[lkey] && e.Tokens.HomeDir != "" {
+		value = ExpandTilde(value, e.Tokens.HomeDir)
+	}
+	lookup := e.LookupEnv
+	if !envKeywords[lkey] {
+		lookup = nil
+	}
+	var ctx *TokenContext
+	allowed, ok := allowedTokens[lkey]
+	if ok {
+		ctx = &e.Tokens
+	}
+	return expandValue(keyword, value, allowed, ctx, lookup)
+}
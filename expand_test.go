@@ -0,0 +1,202 @@
+package ssh_config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testTokenContext = TokenContext{
+	LocalUser:     "kevin",
+	UID:           "501",
+	HomeDir:       "/home/kevin",
+	LocalHostname: "laptop.local",
+	OriginalHost:  "db",
+	Host:          "db.example.com",
+	Port:          "2222",
+	RemoteUser:    "deploy",
+}
+
+var expandTokensTests = []struct {
+	keyword string
+	in      string
+	want    string
+	err     string
+}{
+	{"ControlPath", "~/.ssh/cm-%r@%h:%p", "~/.ssh/cm-deploy@db.example.com:2222", ""},
+	{"ControlPath", "%d/.ssh/%C", "/home/kevin/.ssh/302166b47fd16a0005115b68fce0a8d57818888f", ""},
+	{"IdentityFile", "%d/.ssh/%u-%i-%n-%k", "/home/kevin/.ssh/kevin-501-db-db", ""},
+	{"IdentityFile", "%L and %l", "laptop and laptop.local", ""},
+	{"IdentityFile", "100%%", "100%", ""},
+	{"IdentityFile", "no tokens", "no tokens", ""},
+	{"LocalCommand", "tun %T", "tun NONE", ""},
+	{"ProxyCommand", "nc %h %p", "nc db.example.com 2222", ""},
+	{"HostName", "%h.internal", "db.example.com.internal", ""},
+	{"User", "%h", "%h", ""},
+	{"IdentityFile", "%t", "", "ssh_config: token %t is not allowed in IdentityFile"},
+	{"ProxyCommand", "ssh -W %h:%p %d", "", "ssh_config: token %d is not allowed in ProxyCommand"},
+	{"HostName", "%r", "", "ssh_config: token %r is not allowed in HostName"},
+	{"LocalCommand", "%z", "", "ssh_config: unknown token %z in LocalCommand"},
+	{"ControlPath", "/tmp/%", "", "ssh_config: ControlPath value ends with an incomplete % token"},
+}
+
+func TestExpandTokens(t *testing.T) {
+	for _, tt := range expandTokensTests {
+		ctx := testTokenContext
+		got, err := ExpandTokens(tt.keyword, tt.in, &ctx)
+		if tt.err != "" {
+			if err == nil {
+				t.Errorf("ExpandTokens(%q, %q): expected error, got %q", tt.keyword, tt.in, got)
+				continue
+			}
+			var te *TokenError
+			if !errors.As(err, &te) {
+				t.Errorf("ExpandTokens(%q, %q): expected *TokenError, got %T", tt.keyword, tt.in, err)
+			}
+			if err.Error() != tt.err {
+				t.Errorf("ExpandTokens(%q, %q): got err %q, want %q", tt.keyword, tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ExpandTokens(%q, %q): %v", tt.keyword, tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ExpandTokens(%q, %q): got %q, want %q", tt.keyword, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestConnectionHash(t *testing.T) {
+	ctx := testTokenContext
+	ctx.JumpHost = "bastion"
+	// echo -n "laptop.localdb.example.com2222deploybastion" | sha1sum
+	if got := ctx.ConnectionHash(); got != "8bbad37dada5f8eb4b6c9890ebca68b0ace26549" {
+		t.Errorf("ConnectionHash(): got %q", got)
+	}
+}
+
+func TestResolvedHostExpandTokens(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(`Host db
+    HostName db.example.com
+    User deploy
+    Port 2222
+    ProxyJump bastion
+    ControlPath ~/.ssh/cm-%C
+    IdentityFile %d/.ssh/%r
+    IdentityFile %d/.ssh/%n
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.Resolve("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := TokenContext{LocalUser: "kevin", HomeDir: "/home/kevin", LocalHostname: "laptop.local"}
+	got, err := r.ExpandTokens("ControlPath", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"~/.ssh/cm-8bbad37dada5f8eb4b6c9890ebca68b0ace26549"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpandTokens(ControlPath): got %q, want %q", got, want)
+	}
+	got, err = r.ExpandTokens("IdentityFile", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/home/kevin/.ssh/deploy", "/home/kevin/.ssh/db"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpandTokens(IdentityFile): got %q, want %q", got, want)
+	}
+}
+
+func testLookupEnv(name string) (string, bool) {
+	switch name {
+	case "HOME":
+		return "/home/kevin", true
+	case "EMPTY":
+		return "", true
+	case "TOKEN":
+		return "%h", true
+	}
+	return "", false
+}
+
+var expandEnvTests = []struct {
+	keyword string
+	in      string
+	want    string
+	err     string
+}{
+	{"IdentityFile", "${HOME}/.ssh/id_ed25519", "/home/kevin/.ssh/id_ed25519", ""},
+	{"IdentityFile", "a${EMPTY}b", "ab", ""},
+	{"IdentityFile", "$HOME/${HOME}", "$HOME//home/kevin", ""},
+	{"CertificateFile", "${HOME}", "/home/kevin", ""},
+	{"User", "${HOME}", "${HOME}", ""},
+	{"ProxyCommand", "${HOME}", "${HOME}", ""},
+	{"IdentityFile", "${NOPE}/key", "", "ssh_config: env var ${NOPE} has no value in IdentityFile"},
+	{"IdentityFile", "${HOME", "", "ssh_config: unterminated or empty ${} variable in IdentityFile"},
+	{"IdentityFile", "${}", "", "ssh_config: unterminated or empty ${} variable in IdentityFile"},
+}
+
+func TestExpandEnv(t *testing.T) {
+	for _, tt := range expandEnvTests {
+		got, err := ExpandEnv(tt.keyword, tt.in, testLookupEnv)
+		if tt.err != "" {
+			var ee *EnvError
+			if !errors.As(err, &ee) {
+				t.Errorf("ExpandEnv(%q, %q): expected *EnvError, got %v", tt.keyword, tt.in, err)
+				continue
+			}
+			if err.Error() != tt.err {
+				t.Errorf("ExpandEnv(%q, %q): got err %q, want %q", tt.keyword, tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ExpandEnv(%q, %q): %v", tt.keyword, tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ExpandEnv(%q, %q): got %q, want %q", tt.keyword, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExpanderExpand(t *testing.T) {
+	e := &Expander{Tokens: testTokenContext, LookupEnv: testLookupEnv}
+	tests := []struct {
+		keyword string
+		in      string
+		want    string
+	}{
+		{"IdentityFile", "~/.ssh/%r", "/home/kevin/.ssh/deploy"},
+		// As in ssh, a "%" in an environment variable is not expanded again.
+		{"IdentityFile", "${TOKEN}/key", "%h/key"},
+		{"ControlPath", "${TOKEN}-%h", "%h-db.example.com"},
+		{"UserKnownHostsFile", "~/.ssh/known_hosts ${HOME}/kh-%h", "/home/kevin/.ssh/known_hosts /home/kevin/kh-db.example.com"},
+		{"ProxyCommand", "~/bin/proxy %h", "~/bin/proxy db.example.com"},
+	}
+	for _, tt := range tests {
+		got, err := e.Expand(tt.keyword, tt.in)
+		if err != nil {
+			t.Errorf("Expand(%q, %q): %v", tt.keyword, tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Expand(%q, %q): got %q, want %q", tt.keyword, tt.in, got, tt.want)
+		}
+	}
+
+	// Environment variables are not expanded unless LookupEnv is set.
+	e.LookupEnv = nil
+	got, err := e.Expand("IdentityFile", "${HOME}/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "${HOME}/key" {
+		t.Errorf("Expand without LookupEnv: got %q", got)
+	}
+}
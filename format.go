@@ -0,0 +1,208 @@
+package ssh_config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// FormatOptions control the output of FormatError.
+type FormatOptions struct {
+	// Color highlights the output with ANSI escape codes, for display in a
+	// terminal.
+	Color bool
+}
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[1;31m"
+	ansiGreen = "\x1b[1;32m"
+	ansiCyan  = "\x1b[1;36m"
+)
+
+// errorHints suggest a fix for errors that wrap a sentinel error.
+var errorHints = []struct {
+	err  error
+	hint string
+}{
+	{ErrUnsupportedMatch, "supported criteria are all, canonical, final, exec, host, originalhost, user, localuser, localnetwork, tagged, sessiontype and command"},
+	{ErrInvalidPattern, "patterns may contain the wildcards * and ?, and may be negated with !"},
+	{ErrIncludeGlob, "Include takes file names or glob patterns, such as config.d/*"},
+	{ErrDepthExceeded, "Include directives are nested more than 5 deep; check for a file that includes itself"},
+}
+
+// hintFor returns a suggested fix for err, or the empty string.
+func hintFor(err error) string {
+	for _, h := range errorHints {
+		if errors.Is(err, h.err) {
+			return h.hint
+		}
+	}
+	return ""
+}
+
+// FormatError renders err in the style of a compiler error: the file, line
+// and column, the message, the offending line with a caret under the column,
+// and a hint, if there is one. For example:
+//
+//	config:3:7: error: unsupported Match criterion "bogus"
+//	    3 | Match bogus
+//	      |       ^~~~~
+//	hint: supported criteria are all, canonical, final, ...
+//
+// src is the config that was passed to Decode, DecodeBytes or
+// DecodeWithOptions, and is used to print the line for errors without a file
+// name. For errors in files read from disk, the line is read from the file.
+// If the line cannot be found, only the message is printed.
+//
+// err may be a *ParseError, ParseErrors, a *ValidationError or
+// ValidationErrors; any other error is printed as a message without a line.
+func FormatError(err error, src []byte, opts FormatOptions) string {
+	if err == nil {
+		return ""
+	}
+	var verrs ValidationErrors
+	var ve *ValidationError
+	switch {
+	case errors.As(err, &verrs):
+	case errors.As(err, &ve):
+		verrs = ValidationErrors{ve}
+	}
+	if verrs != nil {
+		var buf strings.Builder
+		for i, ve := range verrs {
+			if i > 0 {
+				buf.WriteByte('\n')
+			}
+			if ve.Pos.Invalid() {
+				buf.WriteString(formatMessage(ve.Error(), opts) + "\n")
+				continue
+			}
+			writeSnippet(&buf, ve.File, ve.Pos, ve.Msg, sourceLine(ve.File, ve.Pos, src), "", opts)
+		}
+		return buf.String()
+	}
+	var errs ParseErrors
+	if !errors.As(err, &errs) {
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			return formatMessage(err.Error(), opts) + "\n"
+		}
+		errs = ParseErrors{pe}
+	}
+	var buf strings.Builder
+	for i, pe := range errs {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		line := sourceLine(pe.File, pe.Pos, src)
+		writeSnippet(&buf, pe.File, pe.Pos, strings.TrimPrefix(cleanMessage(pe.Msg), "ssh_config: "), line, hintFor(pe), opts)
+		if chain := nonEmpty(pe.IncludeChain); len(chain) > 0 {
+			buf.WriteString(colorize("note:", ansiCyan, opts))
+			fmt.Fprintf(&buf, " included from %s\n", strings.Join(chain, " -> "))
+		}
+	}
+	return buf.String()
+}
+
+// writeSnippet writes msg for pos in file, followed by line with a caret
+// under pos and hint.
+func writeSnippet(buf *strings.Builder, file string, pos Position, msg, line, hint string, opts FormatOptions) {
+	if file == "" {
+		file = "config"
+	}
+	buf.WriteString(colorize(fmt.Sprintf("%s:%d:%d:", file, pos.Line, pos.Col), ansiBold, opts))
+	buf.WriteByte(' ')
+	buf.WriteString(formatMessage(msg, opts))
+	buf.WriteByte('\n')
+	if line != "" {
+		gutter := fmt.Sprintf("%5d | ", pos.Line)
+		buf.WriteString(gutter)
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+		buf.WriteString(strings.Repeat(" ", len(gutter)-2))
+		buf.WriteString("| ")
+		buf.WriteString(colorize(caret(line, pos.Col), ansiGreen, opts))
+		buf.WriteByte('\n')
+	}
+	if hint != "" {
+		buf.WriteString(colorize("hint:", ansiCyan, opts))
+		buf.WriteByte(' ')
+		buf.WriteString(hint)
+		buf.WriteByte('\n')
+	}
+}
+
+func formatMessage(msg string, opts FormatOptions) string {
+	return colorize("error:", ansiRed, opts) + " " + colorize(msg, ansiBold, opts)
+}
+
+// caret returns the padding and the marker to print under line, pointing at
+// column col and underlining the rest of the word there. Tabs in the padding
+// are kept so that the caret lines up.
+func caret(line string, col int) string {
+	runes := []rune(line)
+	if col < 1 {
+		col = 1
+	}
+	var buf strings.Builder
+	for i := 0; i < col-1; i++ {
+		if i < len(runes) && runes[i] == '\t' {
+			buf.WriteByte('\t')
+		} else {
+			buf.WriteByte(' ')
+		}
+	}
+	buf.WriteByte('^')
+	for i := col; i < len(runes) && !unicode.IsSpace(runes[i]); i++ {
+		buf.WriteByte('~')
+	}
+	return buf.String()
+}
+
+// cleanMessage removes the "ssh_config: " prefixes that appear inside wrapped
+// messages, such as "Invalid host pattern: ssh_config: invalid pattern".
+func cleanMessage(msg string) string {
+	return strings.ReplaceAll(msg, ": ssh_config: ", ": ")
+}
+
+func colorize(s, code string, opts FormatOptions) string {
+	if !opts.Color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// sourceLine returns the line at pos in file, or in src if file is empty, or
+// the empty string if the line cannot be found.
+func sourceLine(file string, pos Position, src []byte) string {
+	lines := sourceLines(file, src)
+	if pos.Line > 0 && pos.Line <= len(lines) {
+		return strings.TrimSuffix(lines[pos.Line-1], "\r")
+	}
+	return ""
+}
+
+func sourceLines(file string, src []byte) []string {
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil
+		}
+		src = b
+	}
+	return strings.Split(string(src), "\n")
+}
+
+func nonEmpty(files []string) []string {
+	out := make([]string, 0, len(files))
+	for _, f := range files {
+		if f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+package ssh_config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatError(t *testing.T) {
+	src := "Host web\n    User deploy\n\tMatch canonical bogus x\n"
+	_, err := DecodeBytes([]byte(src))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	got := FormatError(err, []byte(src), FormatOptions{})
+	want := `config:3:18: error: unsupported Match criterion "bogus"
+    3 | 	Match canonical bogus x
+      | 	                ^~~~~
+hint: supported criteria are all, canonical, final, exec, host, originalhost, user, localuser, localnetwork, tagged, sessiontype and command
+`
+	if got != want {
+		t.Errorf("FormatError:\ngot\n%s\nwant\n%s", got, want)
+	}
+
+	got = FormatError(err, []byte(src), FormatOptions{Color: true})
+	for _, s := range []string{ansiRed + "error:" + ansiReset, ansiGreen, ansiCyan + "hint:" + ansiReset} {
+		if !strings.Contains(got, s) {
+			t.Errorf("FormatError with Color: missing %q in %q", s, got)
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	src := "Match nope\nInclude [\n"
+	_, err := DecodeWithOptions(strings.NewReader(src), DecodeOptions{Recover: true})
+	got := FormatError(err, []byte(src), FormatOptions{})
+	want := `config:1:7: error: unsupported Match criterion "nope"
+    1 | Match nope
+      |       ^~~~
+hint: supported criteria are all, canonical, final, exec, host, originalhost, user, localuser, localnetwork, tagged, sessiontype and command
+
+config:2:9: error: Error parsing Include directive: invalid Include glob "[": syntax error in pattern
+    2 | Include [
+      |         ^
+hint: Include takes file names or glob patterns, such as config.d/*
+`
+	if got != want {
+		t.Errorf("FormatError:\ngot\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatErrorIncludedFile(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad")
+	if err := os.WriteFile(bad, []byte("Host ok\nMatch user\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := "Include " + bad + "\n"
+	_, err := Decode(strings.NewReader(src))
+	got := FormatError(err, []byte(src), FormatOptions{})
+	want := bad + `:2:7: error: Match user requires at least one pattern
+    2 | Match user
+      |       ^~~~
+`
+	if got != want {
+		t.Errorf("FormatError:\ngot\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatErrorOther(t *testing.T) {
+	if got := FormatError(nil, nil, FormatOptions{}); got != "" {
+		t.Errorf("FormatError(nil): got %q", got)
+	}
+	got := FormatError(errors.New("ssh_config: could not resolve host"), nil, FormatOptions{})
+	if got != "error: ssh_config: could not resolve host\n" {
+		t.Errorf("FormatError: got %q", got)
+	}
+}
+
+func TestFormatValidationError(t *testing.T) {
+	src := "Host web\n    StrictHostKeyChecking maybe\n"
+	cfg, err := DecodeBytes([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := FormatError(cfg.Validate(), []byte(src), FormatOptions{})
+	want := `config:2:27: error: value for key "StrictHostKeyChecking" must be one of yes, accept-new, no, off, ask, true, false, got "maybe"
+    2 |     StrictHostKeyChecking maybe
+      |                           ^~~~~
+`
+	if got != want {
+		t.Errorf("FormatError:\ngot\n%s\nwant\n%s", got, want)
+	}
+}
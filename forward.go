@@ -0,0 +1,213 @@
+package ssh_config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Forward is a port forwarding specification, the value of a LocalForward,
+// RemoteForward or DynamicForward keyword. Each side of the forward is either
+// a host and port or a Unix socket path.
+type Forward struct {
+	// ListenHost is the address to bind to, without square brackets. It is
+	// "*" to bind to every address, and empty if no address was given.
+	ListenHost string
+	// ListenPort is the port to listen on. It is 0 if ListenPath is set, or
+	// if a RemoteForward asks the server to choose a port.
+	ListenPort int
+	// ListenPath is the Unix socket to listen on, if any.
+	ListenPath string
+	// ConnectHost and ConnectPort are the host and port to connect to, with
+	// no square brackets around ConnectHost. They are empty for
+	// DynamicForward, and for a RemoteForward that acts as a SOCKS proxy.
+	ConnectHost string
+	ConnectPort int
+	// ConnectPath is the Unix socket to connect to, if any.
+	ConnectPath string
+}
+
+// Dynamic reports whether f has no destination, as for DynamicForward or a
+// RemoteForward with a single argument. The destination of each connection
+// is chosen by the SOCKS client.
+func (f *Forward) Dynamic() bool {
+	return f.ConnectHost == "" && f.ConnectPath == ""
+}
+
+// String formats f as the value of a forwarding keyword, e.g.
+// "[::1]:8080 db.internal:5432". Hosts that contain a ":" are enclosed in
+// square brackets.
+func (f *Forward) String() string {
+	var buf strings.Builder
+	if f.ListenPath != "" {
+		buf.WriteString(f.ListenPath)
+	} else {
+		if f.ListenHost != "" {
+			buf.WriteString(bracketHost(f.ListenHost))
+			buf.WriteByte(':')
+		}
+		buf.WriteString(strconv.Itoa(f.ListenPort))
+	}
+	switch {
+	case f.ConnectPath != "":
+		buf.WriteByte(' ')
+		buf.WriteString(f.ConnectPath)
+	case f.ConnectHost != "":
+		buf.WriteByte(' ')
+		buf.WriteString(bracketHost(f.ConnectHost))
+		buf.WriteByte(':')
+		buf.WriteString(strconv.Itoa(f.ConnectPort))
+	}
+	return buf.String()
+}
+
+func bracketHost(host string) string {
+	if strings.ContainsRune(host, ':') {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// ParseForward parses value, which was set for keyword: LocalForward,
+// RemoteForward or DynamicForward. The forms that ssh accepts are:
+//
+//	DynamicForward [bind_address:]port
+//	LocalForward   [bind_address:]port host:hostport
+//	LocalForward   [bind_address:]port remote_socket
+//	LocalForward   local_socket host:hostport
+//	LocalForward   local_socket remote_socket
+//	RemoteForward  any of the LocalForward forms, or [bind_address:]port
+//
+// An IPv6 address must be enclosed in square brackets, e.g. "[::1]:8080". As
+// in ssh, a field that contains a "/" is a Unix socket path; a path may also
+// start with a ${VAR} reference or a percent token. The listen port may only
+// be 0 for RemoteForward, which asks the server to choose a port.
+//
+// ParseForward does not expand ${VAR} references or percent tokens in socket
+// paths; use Expander.ParseForward for that. The error is a *ValidationError.
+func ParseForward(keyword, value string) (*Forward, error) {
+	lkey := strings.ToLower(keyword)
+	if lkey != "localforward" && lkey != "remoteforward" && lkey != "dynamicforward" {
+		return nil, fmt.Errorf("ssh_config: %s is not a forwarding keyword", keyword)
+	}
+	f := &Forward{}
+	fields := strings.Fields(value)
+	var ok bool
+	switch {
+	case len(fields) == 1 && lkey != "localforward":
+		ok = f.parseListen(fields[0], false)
+	case len(fields) == 2 && lkey != "dynamicforward":
+		ok = f.parseListen(fields[0], true) && f.parseConnect(fields[1])
+	}
+	if ok && f.ListenPath == "" && f.ListenPort == 0 && lkey != "remoteforward" {
+		ok = false
+	}
+	if ok {
+		return f, nil
+	}
+	var form string
+	switch lkey {
+	case "dynamicforward":
+		form = "[bind_address:]port"
+	case "localforward":
+		form = "[bind_address:]port host:hostport"
+	default:
+		form = "[bind_address:]port [host:hostport]"
+	}
+	return nil, &ValidationError{
+		Key:   keyword,
+		Value: value,
+		Msg:   fmt.Sprintf("value for key %q must be %s, got %q", keyword, form, value),
+	}
+}
+
+// parseListen parses "[bind_address:]port", or a Unix socket path if socket
+// is true.
+func (f *Forward) parseListen(s string, socket bool) bool {
+	if isSocketPath(s) {
+		f.ListenPath = s
+		return socket
+	}
+	host, port, ok := splitHostPort(s)
+	if !ok {
+		return false
+	}
+	f.ListenHost = host
+	f.ListenPort, ok = parsePort(port)
+	return ok
+}
+
+// parseConnect parses "host:hostport" or a Unix socket path.
+func (f *Forward) parseConnect(s string) bool {
+	if isSocketPath(s) {
+		f.ConnectPath = s
+		return true
+	}
+	host, port, ok := splitHostPort(s)
+	if !ok || host == "" {
+		return false
+	}
+	f.ConnectHost = host
+	f.ConnectPort, ok = parsePort(port)
+	return ok && f.ConnectPort != 0
+}
+
+// isSocketPath reports whether s is a Unix socket path, before or after
+// expansion. As in parse_fwd_field in ssh, any field that contains a "/" is a
+// path.
+func isSocketPath(s string) bool {
+	return strings.ContainsRune(s, '/') || strings.HasPrefix(s, "${") || strings.HasPrefix(s, "%")
+}
+
+// splitHostPort splits s at its last ":". An IPv6 host must be enclosed in
+// square brackets, which are removed. If s has no separator, the host is
+// empty.
+func splitHostPort(s string) (host, port string, ok bool) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return "", s, true
+	}
+	host, port = s[:i], s[i+1:]
+	if strings.HasPrefix(host, "[") {
+		if !strings.HasSuffix(host, "]") {
+			return "", "", false
+		}
+		host = host[1 : len(host)-1]
+	} else if strings.ContainsAny(host, ":[]") {
+		return "", "", false
+	}
+	return host, port, true
+}
+
+func parsePort(s string) (int, bool) {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n > 65535 {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// ParseForward is like the ParseForward function, but also expands ${VAR}
+// references and percent tokens in Unix socket paths, as ssh does. Hosts and
+// ports are not expanded.
+func (e *Expander) ParseForward(keyword, value string) (*Forward, error) {
+	f, err := ParseForward(keyword, value)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range []*string{&f.ListenPath, &f.ConnectPath} {
+		if *path == "" {
+			continue
+		}
+		if *path, err = e.expand(keyword, *path); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// SetForward sets the value for k to f, which should be the value for a
+// LocalForward, RemoteForward or DynamicForward keyword.
+func (k *KV) SetForward(f *Forward) error {
+	return k.SetValue(f.String())
+}
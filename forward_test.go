@@ -0,0 +1,123 @@
+package ssh_config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var forwardTests = []struct {
+	keyword string
+	value   string
+	want    *Forward
+	str     string
+}{
+	{"LocalForward", "8080 localhost:80", &Forward{ListenPort: 8080, ConnectHost: "localhost", ConnectPort: 80}, ""},
+	{"LocalForward", "[::1]:8080 db.internal:5432", &Forward{ListenHost: "::1", ListenPort: 8080, ConnectHost: "db.internal", ConnectPort: 5432}, ""},
+	{"LocalForward", "127.0.0.1:8080 [2001:db8::1]:22", &Forward{ListenHost: "127.0.0.1", ListenPort: 8080, ConnectHost: "2001:db8::1", ConnectPort: 22}, ""},
+	{"LocalForward", "localhost:80 run/sock", &Forward{ListenHost: "localhost", ListenPort: 80, ConnectPath: "run/sock"}, ""},
+	{"LocalForward", "8080 host/22", &Forward{ListenPort: 8080, ConnectPath: "host/22"}, ""},
+	{"LocalForward", "/tmp/sock remote:80", &Forward{ListenPath: "/tmp/sock", ConnectHost: "remote", ConnectPort: 80}, ""},
+	{"LocalForward", "8080 /var/run/docker.sock", &Forward{ListenPort: 8080, ConnectPath: "/var/run/docker.sock"}, ""},
+	{"LocalForward", "*:8080   localhost:80", &Forward{ListenHost: "*", ListenPort: 8080, ConnectHost: "localhost", ConnectPort: 80}, "*:8080 localhost:80"},
+	{"RemoteForward", "8080", &Forward{ListenPort: 8080}, ""},
+	{"RemoteForward", "[::]:0", &Forward{ListenHost: "::"}, ""},
+	{"RemoteForward", "/run/user/1000/gnupg/S.gpg-agent /home/me/.gnupg/S.gpg-agent.extra", &Forward{ListenPath: "/run/user/1000/gnupg/S.gpg-agent", ConnectPath: "/home/me/.gnupg/S.gpg-agent.extra"}, ""},
+	{"DynamicForward", "localhost:1080", &Forward{ListenHost: "localhost", ListenPort: 1080}, ""},
+	{"dynamicforward", "1080", &Forward{ListenPort: 1080}, ""},
+
+	{"LocalForward", "8080", nil, ""},
+	{"LocalForward", "8080 localhost", nil, ""},
+	{"LocalForward", "8080 :80", nil, ""},
+	{"LocalForward", "::1:8080 localhost:80", nil, ""},
+	{"LocalForward", "[::1:8080 localhost:80", nil, ""},
+	{"LocalForward", "70000 localhost:80", nil, ""},
+	{"LocalForward", "0 h:1", nil, ""},
+	{"LocalForward", "8080 h:0", nil, ""},
+	{"DynamicForward", "0", nil, ""},
+	{"DynamicForward", "localhost/1080", nil, ""},
+	{"RemoteForward", "/tmp/sock", nil, ""},
+	{"DynamicForward", "/tmp/sock", nil, ""},
+	{"DynamicForward", "1080 localhost:80", nil, ""},
+}
+
+func TestParseForward(t *testing.T) {
+	for _, tt := range forwardTests {
+		got, err := ParseForward(tt.keyword, tt.value)
+		if tt.want == nil {
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Errorf("ParseForward(%q, %q): got %+v, %v, want a *ValidationError", tt.keyword, tt.value, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseForward(%q, %q): %v", tt.keyword, tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseForward(%q, %q): got %+v, want %+v", tt.keyword, tt.value, got, tt.want)
+		}
+		str := tt.str
+		if str == "" {
+			str = tt.value
+		}
+		if got.String() != str {
+			t.Errorf("ParseForward(%q, %q).String(): got %q, want %q", tt.keyword, tt.value, got.String(), str)
+		}
+	}
+	if _, err := ParseForward("Port", "22"); err == nil {
+		t.Error("ParseForward(Port): expected an error")
+	}
+}
+
+func TestExpanderParseForward(t *testing.T) {
+	e := &Expander{
+		Tokens:    TokenContext{HomeDir: "/home/me", LocalUser: "me"},
+		LookupEnv: testLookupEnv,
+	}
+	f, err := e.ParseForward("RemoteForward", "/run/user/%u/S.gpg-agent ${HOME}/.gnupg/S.gpg-agent.extra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.ListenPath != "/run/user/me/S.gpg-agent" || f.ConnectPath != "/home/kevin/.gnupg/S.gpg-agent.extra" {
+		t.Errorf("got %+v", f)
+	}
+}
+
+func TestGetForwards(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(`Host web
+    LocalForward 8080 localhost:80
+    LocalForward [::1]:5432 db.internal:5432
+    RemoteForward 9000 bogus
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fwds, err := r.GetForwards("LocalForward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fwds) != 2 || fwds[1].ListenHost != "::1" || fwds[1].ConnectHost != "db.internal" {
+		t.Errorf("got %+v", fwds)
+	}
+	_, err = r.GetForwards("RemoteForward")
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Pos != (Position{Line: 4, Col: 19}) {
+		t.Errorf("got %v, want a *ValidationError at (4, 19)", err)
+	}
+
+	kv := cfg.Hosts[1].Nodes[0].(*KV)
+	fwds[0].ListenHost = "127.0.0.1"
+	if err := kv.SetForward(fwds[0]); err != nil {
+		t.Fatal(err)
+	}
+	if want := "    LocalForward 127.0.0.1:8080 localhost:80"; kv.String() != want {
+		t.Errorf("got %q, want %q", kv.String(), want)
+	}
+}
@@ -0,0 +1,234 @@
+package ssh_config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The typed getters below parse the value for a keyword using the grammar in
+// ssh_config(5). Errors are a *ValidationError, which records the file and
+// position of the value if it was read from a config file.
+
+// first returns the first value for key, or nil if key was not set.
+func (r *ResolvedHost) first(key string) *resolvedValue {
+	vals := r.values[canonicalKey(key)]
+	if len(vals) == 0 {
+		return nil
+	}
+	return vals[0]
+}
+
+// valueError returns a *ValidationError for v, the value of key.
+func valueError(key string, v *resolvedValue, format string, args ...interface{}) *ValidationError {
+	ve := &ValidationError{
+		Key:   key,
+		Value: v.value,
+		Msg:   fmt.Sprintf("value for key %q must be ", key) + fmt.Sprintf(format, args...),
+	}
+	if v.src != nil {
+		ve.File = v.src.File
+		ve.Pos = v.src.KV.valuePos()
+	}
+	return ve
+}
+
+// GetBool returns the value for key as a flag. "yes" and "true" are true, and
+// "no" and "false" are false, ignoring case, as in ssh. GetBool returns false
+// and a nil error if key was not set; use Has to tell the difference.
+func (r *ResolvedHost) GetBool(key string) (bool, error) {
+	v := r.first(key)
+	if v == nil {
+		return false, nil
+	}
+	switch strings.ToLower(v.value) {
+	case "yes", "true":
+		return true, nil
+	case "no", "false":
+		return false, nil
+	}
+	return false, valueError(key, v, "yes or no, got %q", v.value)
+}
+
+// GetInt returns the value for key as a non-negative integer, for keywords
+// such as Port and ConnectionAttempts. GetInt returns 0 and a nil error if
+// key was not set.
+func (r *ResolvedHost) GetInt(key string) (int, error) {
+	v := r.first(key)
+	if v == nil {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(v.value, 10, 31)
+	if err != nil {
+		ve := valueError(key, v, "a non-negative integer, got %q", v.value)
+		ve.Err = err
+		return 0, ve
+	}
+	return int(n), nil
+}
+
+// GetDuration returns the value for key as a time interval, in the format
+// described in the TIME FORMATS section of sshd_config(5): a number of
+// seconds such as "30", or a sequence such as "1h30m". "none" is returned as
+// 0. GetDuration returns 0 and a nil error if key was not set.
+//
+// Some keywords also accept words that are not time intervals, such as "yes"
+// for ControlPersist; GetDuration returns an error for these, so check Get
+// first.
+func (r *ResolvedHost) GetDuration(key string) (time.Duration, error) {
+	v := r.first(key)
+	if v == nil || strings.EqualFold(v.value, "none") {
+		return 0, nil
+	}
+	secs, err := parseTime(v.value)
+	if err != nil {
+		ve := valueError(key, v, "a time interval such as 30, 10m or 1h30m, got %q", v.value)
+		ve.Err = err
+		return 0, ve
+	}
+	return time.Duration(secs) * time.Second, nil
+}
+
+// GetList splits the values for key into a list. Algorithm lists such as
+// Ciphers are split at commas; a leading "+", "-" or "^" is kept on the first
+// element, so use GetAlgorithms to apply it to the default list. Path lists
+// such as UserKnownHostsFile are split at whitespace, and a path may be
+// enclosed in double quotes to include spaces. Other lists, such as
+// PreferredAuthentications or SendEnv, are split at commas and whitespace.
+//
+// If key may be specified multiple times, the lists from every value are
+// joined. GetList returns nil and a nil error if key was not set.
+func (r *ResolvedHost) GetList(key string) ([]string, error) {
+	vals := r.values[canonicalKey(key)]
+	typ := ValueList
+	if kw, ok := LookupKeyword(key); ok {
+		typ = kw.Type
+	}
+	var list []string
+	for _, v := range vals {
+		switch typ {
+		case ValueAlgorithms:
+			list = append(list, strings.Split(v.value, ",")...)
+		case ValuePathList:
+			paths, ok := splitPaths(v.value, v.kv())
+			if !ok {
+				return nil, valueError(key, v, "a list of paths with matching quotes, got %q", v.value)
+			}
+			list = append(list, paths...)
+		default:
+			list = append(list, strings.FieldsFunc(v.value, func(r rune) bool {
+				return r == ',' || r == ' ' || r == '\t'
+			})...)
+		}
+	}
+	return list, nil
+}
+
+// isPathList reports whether key takes a list of paths, such as
+// UserKnownHostsFile.
+func isPathList(key string) bool {
+	kw, ok := LookupKeyword(key)
+	return ok && kw.Type == ValuePathList
+}
+
+// splitPaths splits value, the value of a path list keyword, into paths. kv is
+// the line that set value, or nil for a default. It reports false if a quote
+// is not closed.
+func splitPaths(value string, kv *KV) ([]string, bool) {
+	// Use the value as written, since Value has lost the quotes if the whole
+	// value was quoted.
+	raw := value
+	if kv != nil && kv.rawValue != "" {
+		raw = kv.rawValue
+	}
+	return splitQuoted(raw)
+}
+
+// appendValue appends value, which was set for key by kv, to list. Path lists
+// such as UserKnownHostsFile are split into one element per path, so that
+// values from config files have the same shape as defaults; see DefaultAll.
+func appendValue(list []string, key, value string, kv *KV) []string {
+	if isPathList(key) {
+		if paths, ok := splitPaths(value, kv); ok {
+			return append(list, paths...)
+		}
+	}
+	return append(list, value)
+}
+
+// splitQuoted splits s at whitespace, treating text between double quotes as
+// part of a single field. It reports false if a quote is not closed.
+func splitQuoted(s string) ([]string, bool) {
+	var fields []string
+	var buf strings.Builder
+	inField, inQuote := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+			inField = true
+		case (c == ' ' || c == '\t') && !inQuote:
+			if inField {
+				fields = append(fields, buf.String())
+				buf.Reset()
+				inField = false
+			}
+		default:
+			buf.WriteByte(c)
+			inField = true
+		}
+	}
+	if inQuote {
+		return nil, false
+	}
+	if inField {
+		fields = append(fields, buf.String())
+	}
+	return fields, true
+}
+
+// GetEnum returns the value for key, which must be one of the values that the
+// keyword catalog allows, such as "accept-new" for StrictHostKeyChecking. The
+// match is case insensitive, and the value is returned as it is spelled in the
+// catalog. GetEnum returns the empty string and a nil error if key was not
+// set.
+func (r *ResolvedHost) GetEnum(key string) (string, error) {
+	v := r.first(key)
+	if v == nil {
+		return "", nil
+	}
+	kw, ok := LookupKeyword(key)
+	if !ok || len(kw.Values) == 0 {
+		ve := valueError(key, v, "")
+		ve.Msg = fmt.Sprintf("%s does not have a fixed set of values", key)
+		return "", ve
+	}
+	for _, allowed := range kw.Values {
+		if strings.EqualFold(allowed, v.value) {
+			return allowed, nil
+		}
+	}
+	return "", valueError(key, v, "one of %s, got %q", strings.Join(kw.Values, ", "), v.value)
+}
+
+// GetForwards parses every value for key, which should be LocalForward,
+// RemoteForward or DynamicForward. See ParseForward for the forms that are
+// accepted. GetForwards returns nil and a nil error if key was not set.
+func (r *ResolvedHost) GetForwards(key string) ([]*Forward, error) {
+	vals := r.values[canonicalKey(key)]
+	var fwds []*Forward
+	for _, v := range vals {
+		f, err := ParseForward(key, v.value)
+		if err != nil {
+			if ve, ok := err.(*ValidationError); ok && v.src != nil {
+				ve.File = v.src.File
+				ve.Pos = v.src.KV.valuePos()
+			}
+			return nil, err
+		}
+		fwds = append(fwds, f)
+	}
+	return fwds, nil
+}
@@ -0,0 +1,118 @@
+package ssh_config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var gettersConfig = `Host web
+    Compression true
+    ForwardX11 No
+    ConnectionAttempts 3
+    ConnectTimeout 1m30s
+    ControlPersist 10m
+    ServerAliveInterval none
+    Ciphers +aes128-cbc,aes192-cbc
+    UserKnownHostsFile ~/.ssh/known_hosts "/etc/ssh/known hosts"
+    SendEnv LANG LC_*
+    SendEnv TZ
+    PreferredAuthentications publickey,password
+    StrictHostKeyChecking Accept-New
+
+Host bad
+    Compression maybe
+    ConnectionAttempts -1
+    ConnectTimeout soon
+    StrictHostKeyChecking maybe
+    User "unterminated
+    UserKnownHostsFile "/a b
+`
+
+func TestTypedGetters(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(gettersConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := r.GetBool("Compression"); err != nil || !b {
+		t.Errorf("GetBool(Compression): got %t, %v", b, err)
+	}
+	if b, err := r.GetBool("ForwardX11"); err != nil || b {
+		t.Errorf("GetBool(ForwardX11): got %t, %v", b, err)
+	}
+	if b, err := r.GetBool("BatchMode"); err != nil || b {
+		t.Errorf("GetBool(BatchMode): got %t, %v", b, err)
+	}
+	if n, err := r.GetInt("ConnectionAttempts"); err != nil || n != 3 {
+		t.Errorf("GetInt(ConnectionAttempts): got %d, %v", n, err)
+	}
+	for key, want := range map[string]time.Duration{
+		"ConnectTimeout":      90 * time.Second,
+		"ControlPersist":      10 * time.Minute,
+		"ServerAliveInterval": 0,
+		"ForwardX11Timeout":   0,
+	} {
+		if d, err := r.GetDuration(key); err != nil || d != want {
+			t.Errorf("GetDuration(%s): got %v, %v, want %v", key, d, err, want)
+		}
+	}
+	for key, want := range map[string][]string{
+		"Ciphers":                  {"+aes128-cbc", "aes192-cbc"},
+		"UserKnownHostsFile":       {"~/.ssh/known_hosts", "/etc/ssh/known hosts"},
+		"SendEnv":                  {"LANG", "LC_*", "TZ"},
+		"PreferredAuthentications": {"publickey", "password"},
+		"IdentityFile":             nil,
+	} {
+		if list, err := r.GetList(key); err != nil || !reflect.DeepEqual(list, want) {
+			t.Errorf("GetList(%s): got %q, %v, want %q", key, list, err, want)
+		}
+	}
+	if s, err := r.GetEnum("StrictHostKeyChecking"); err != nil || s != "accept-new" {
+		t.Errorf("GetEnum(StrictHostKeyChecking): got %q, %v", s, err)
+	}
+}
+
+func TestTypedGettersErrors(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(gettersConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.Resolve("bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(key string, err error, line int) {
+		t.Helper()
+		var ve *ValidationError
+		if !errors.As(err, &ve) {
+			t.Errorf("%s: expected a *ValidationError, got %v", key, err)
+			return
+		}
+		if ve.Key != key || ve.Pos.Line != line || ve.Pos.Col <= len(key) {
+			t.Errorf("%s: got %+v", key, ve)
+		}
+	}
+	_, err = r.GetBool("Compression")
+	check("Compression", err, 16)
+	_, err = r.GetInt("ConnectionAttempts")
+	check("ConnectionAttempts", err, 17)
+	_, err = r.GetDuration("ConnectTimeout")
+	check("ConnectTimeout", err, 18)
+	_, err = r.GetEnum("StrictHostKeyChecking")
+	check("StrictHostKeyChecking", err, 19)
+	_, err = r.GetEnum("User")
+	check("User", err, 20)
+	_, err = r.GetList("UserKnownHostsFile")
+	check("UserKnownHostsFile", err, 21)
+
+	want := `(18, 20): ssh_config: value for key "ConnectTimeout" must be a time interval such as 30, 10m or 1h30m, got "soon"`
+	if _, err := r.GetDuration("ConnectTimeout"); err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,279 @@
+package ssh_config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValueType describes the kind of value that a keyword takes.
+type ValueType int
+
+const (
+	// ValueString is any string.
+	ValueString ValueType = iota
+	// ValueFlag is "yes" or "no". As in ssh, "true" and "false" are also
+	// accepted, and case is ignored.
+	ValueFlag
+	// ValueUint is a non-negative integer.
+	ValueUint
+	// ValueDuration is a time interval, in the format described in the TIME
+	// FORMATS section of sshd_config(5), e.g. "90" or "1h30m".
+	ValueDuration
+	// ValueEnum is one of the values in Keyword.Values.
+	ValueEnum
+	// ValueAlgorithms is a comma-separated list of algorithms, which may
+	// start with "+", "-" or "^" to modify the default list.
+	ValueAlgorithms
+	// ValuePath is a file or socket path.
+	ValuePath
+	// ValuePathList is a whitespace-separated list of paths.
+	ValuePathList
+	// ValueForward is a port forwarding specification, as for LocalForward.
+	ValueForward
+	// ValueCommand is a command line that is passed to the shell.
+	ValueCommand
+	// ValueList is a list of words, separated by whitespace or commas.
+	ValueList
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case ValueString:
+		return "string"
+	case ValueFlag:
+		return "flag"
+	case ValueUint:
+		return "uint"
+	case ValueDuration:
+		return "duration"
+	case ValueEnum:
+		return "enum"
+	case ValueAlgorithms:
+		return "algorithms"
+	case ValuePath:
+		return "path"
+	case ValuePathList:
+		return "path list"
+	case ValueForward:
+		return "forward"
+	case ValueCommand:
+		return "command"
+	case ValueList:
+		return "list"
+	}
+	return fmt.Sprintf("ValueType(%d)", int(t))
+}
+
+// Keyword describes an ssh_config keyword.
+type Keyword struct {
+	// Name is the keyword as it is spelled in the ssh_config manpage.
+	Name string
+	// Type is the kind of value the keyword takes.
+	Type ValueType
+	// Values lists the allowed values for a ValueEnum keyword. For other
+	// types, Values lists special words that are accepted in addition to a
+	// value of the type, e.g. "none" for ProxyJump, or "yes" and "no" for
+	// ControlPersist.
+	Values []string
+	// Multiple reports whether the keyword may be specified more than once,
+	// with every value being used. See SupportsMultiple.
+	Multiple bool
+	// Tokens lists the percent tokens that are expanded in the value, without
+	// the "%", e.g. "hnpr". Tokens is empty if the keyword does not support
+	// tokens. See ExpandTokens.
+	Tokens string
+	// Env reports whether ${VAR} references are expanded in the value. See
+	// ExpandEnv.
+	Env bool
+	// Tilde reports whether a leading "~" is expanded to the home directory.
+	// See ExpandTilde.
+	Tilde bool
+	// Default is the default value, if there is one. See Default.
+	Default string
+	// Aliases lists other names for the keyword, which are usually obsolete.
+	Aliases []string
+	// Since is the OpenSSH version that added the keyword, e.g. "7.3". Since
+	// is empty for keywords that are older than OpenSSH 5.6.
+	Since string
+	// Deprecated is the OpenSSH version that deprecated or removed the
+	// keyword, or the empty string if the keyword is current.
+	Deprecated string
+}
+
+// keywords lists every keyword in ssh_config(5), and a few obsolete ones.
+// Multiple, Tokens, Env, Tilde and Default are filled in by init from the
+// tables that are used to look up and expand values.
+var keywords = []Keyword{
+	{Name: "AddKeysToAgent", Type: ValueEnum, Values: []string{"yes", "no", "ask", "confirm", "true", "false"}, Since: "7.2"},
+	{Name: "AddressFamily", Type: ValueEnum, Values: []string{"any", "inet", "inet6"}},
+	{Name: "BatchMode", Type: ValueFlag},
+	{Name: "BindAddress", Type: ValueString},
+	{Name: "BindInterface", Type: ValueString, Since: "7.7"},
+	{Name: "CanonicalDomains", Type: ValueList, Values: []string{"none"}, Since: "6.5"},
+	{Name: "CanonicalizeFallbackLocal", Type: ValueFlag, Since: "6.5"},
+	{Name: "CanonicalizeHostname", Type: ValueEnum, Values: []string{"yes", "no", "true", "false", "always"}, Since: "6.5"},
+	{Name: "CanonicalizeMaxDots", Type: ValueUint, Since: "6.5"},
+	{Name: "CanonicalizePermittedCNAMEs", Type: ValueList, Values: []string{"none"}, Since: "6.5"},
+	{Name: "CASignatureAlgorithms", Type: ValueAlgorithms, Since: "7.9"},
+	{Name: "CertificateFile", Type: ValuePath, Since: "7.2"},
+	{Name: "ChannelTimeout", Type: ValueList, Values: []string{"none"}, Since: "9.2"},
+	{Name: "CheckHostIP", Type: ValueFlag},
+	{Name: "Cipher", Type: ValueString, Deprecated: "7.6"},
+	{Name: "Ciphers", Type: ValueAlgorithms},
+	{Name: "ClearAllForwardings", Type: ValueFlag},
+	{Name: "Compression", Type: ValueFlag},
+	{Name: "CompressionLevel", Type: ValueUint, Deprecated: "7.6"},
+	{Name: "ConnectionAttempts", Type: ValueUint},
+	{Name: "ConnectTimeout", Type: ValueDuration, Values: []string{"none"}},
+	{Name: "ControlMaster", Type: ValueEnum, Values: []string{"yes", "no", "ask", "auto", "autoask", "true", "false"}},
+	{Name: "ControlPath", Type: ValuePath, Values: []string{"none"}},
+	{Name: "ControlPersist", Type: ValueDuration, Values: []string{"yes", "no", "true", "false"}, Since: "5.6"},
+	{Name: "DynamicForward", Type: ValueForward},
+	{Name: "EnableEscapeCommandline", Type: ValueFlag, Since: "9.2"},
+	{Name: "EnableSSHKeysign", Type: ValueFlag},
+	{Name: "EscapeChar", Type: ValueString, Values: []string{"none"}},
+	{Name: "ExitOnForwardFailure", Type: ValueFlag},
+	{Name: "FingerprintHash", Type: ValueEnum, Values: []string{"md5", "sha256"}, Since: "6.8"},
+	{Name: "ForkAfterAuthentication", Type: ValueFlag, Since: "8.7"},
+	{Name: "ForwardAgent", Type: ValuePath, Values: []string{"yes", "no", "true", "false"}},
+	{Name: "ForwardX11", Type: ValueFlag},
+	{Name: "ForwardX11Timeout", Type: ValueDuration},
+	{Name: "ForwardX11Trusted", Type: ValueFlag},
+	{Name: "GatewayPorts", Type: ValueFlag},
+	{Name: "GlobalKnownHostsFile", Type: ValuePathList},
+	{Name: "GSSAPIAuthentication", Type: ValueFlag},
+	{Name: "GSSAPIDelegateCredentials", Type: ValueFlag},
+	{Name: "HashKnownHosts", Type: ValueFlag},
+	{Name: "HostbasedAcceptedAlgorithms", Type: ValueAlgorithms, Aliases: []string{"HostbasedKeyTypes"}, Since: "8.5"},
+	{Name: "HostbasedAuthentication", Type: ValueFlag},
+	{Name: "HostKeyAlgorithms", Type: ValueAlgorithms},
+	{Name: "HostKeyAlias", Type: ValueString},
+	{Name: "HostName", Type: ValueString},
+	{Name: "IdentitiesOnly", Type: ValueFlag},
+	{Name: "IdentityAgent", Type: ValuePath, Values: []string{"none", "SSH_AUTH_SOCK"}, Since: "7.3"},
+	{Name: "IdentityFile", Type: ValuePath},
+	{Name: "IgnoreUnknown", Type: ValueList, Since: "6.3"},
+	{Name: "Include", Type: ValuePathList, Since: "7.3"},
+	{Name: "IPQoS", Type: ValueList, Since: "5.7"},
+	{Name: "KbdInteractiveAuthentication", Type: ValueFlag, Aliases: []string{"ChallengeResponseAuthentication"}},
+	{Name: "KbdInteractiveDevices", Type: ValueList},
+	{Name: "KexAlgorithms", Type: ValueAlgorithms, Since: "5.7"},
+	{Name: "KnownHostsCommand", Type: ValueCommand, Values: []string{"none"}, Since: "8.5"},
+	{Name: "LocalCommand", Type: ValueCommand},
+	{Name: "LocalForward", Type: ValueForward},
+	{Name: "LogLevel", Type: ValueEnum, Values: []string{"QUIET", "FATAL", "ERROR", "INFO", "VERBOSE", "DEBUG", "DEBUG1", "DEBUG2", "DEBUG3"}},
+	{Name: "LogVerbose", Type: ValueList, Since: "8.5"},
+	{Name: "MACs", Type: ValueAlgorithms},
+	{Name: "NoHostAuthenticationForLocalhost", Type: ValueFlag},
+	{Name: "NumberOfPasswordPrompts", Type: ValueUint},
+	{Name: "ObscureKeystrokeTiming", Type: ValueString, Values: []string{"yes", "no", "true", "false"}, Since: "9.5"},
+	{Name: "PasswordAuthentication", Type: ValueFlag},
+	{Name: "PermitLocalCommand", Type: ValueFlag},
+	{Name: "PermitRemoteOpen", Type: ValueList, Values: []string{"any", "none"}, Since: "8.2"},
+	{Name: "PKCS11Provider", Type: ValuePath, Values: []string{"none"}},
+	{Name: "Port", Type: ValueUint},
+	{Name: "PreferredAuthentications", Type: ValueList},
+	{Name: "Protocol", Type: ValueString, Deprecated: "7.6"},
+	{Name: "ProxyCommand", Type: ValueCommand, Values: []string{"none"}},
+	{Name: "ProxyJump", Type: ValueString, Values: []string{"none"}, Since: "7.3"},
+	{Name: "ProxyUseFdpass", Type: ValueFlag, Since: "6.5"},
+	{Name: "PubkeyAcceptedAlgorithms", Type: ValueAlgorithms, Aliases: []string{"PubkeyAcceptedKeyTypes"}, Since: "8.5"},
+	{Name: "PubkeyAuthentication", Type: ValueEnum, Values: []string{"yes", "no", "unbound", "host-bound", "true", "false"}},
+	{Name: "RekeyLimit", Type: ValueString},
+	{Name: "RemoteCommand", Type: ValueCommand, Values: []string{"none"}, Since: "7.6"},
+	{Name: "RemoteForward", Type: ValueForward},
+	{Name: "RequestTTY", Type: ValueEnum, Values: []string{"no", "yes", "force", "auto", "true", "false"}, Since: "5.9"},
+	{Name: "RequiredRSASize", Type: ValueUint, Since: "9.1"},
+	{Name: "RevokedHostKeys", Type: ValuePath, Since: "7.3"},
+	{Name: "RhostsRSAAuthentication", Type: ValueFlag, Deprecated: "7.6"},
+	{Name: "RSAAuthentication", Type: ValueFlag, Deprecated: "7.6"},
+	{Name: "SecurityKeyProvider", Type: ValuePath, Since: "8.2"},
+	{Name: "SendEnv", Type: ValueList},
+	{Name: "ServerAliveCountMax", Type: ValueUint},
+	{Name: "ServerAliveInterval", Type: ValueDuration},
+	{Name: "SessionType", Type: ValueEnum, Values: []string{"none", "subsystem", "default"}, Since: "8.7"},
+	{Name: "SetEnv", Type: ValueList, Since: "7.8"},
+	{Name: "StdinNull", Type: ValueFlag, Since: "8.7"},
+	{Name: "StreamLocalBindMask", Type: ValueString, Since: "6.7"},
+	{Name: "StreamLocalBindUnlink", Type: ValueFlag, Since: "6.7"},
+	{Name: "StrictHostKeyChecking", Type: ValueEnum, Values: []string{"yes", "accept-new", "no", "off", "ask", "true", "false"}},
+	{Name: "SyslogFacility", Type: ValueEnum, Values: []string{"DAEMON", "USER", "AUTH", "LOCAL0", "LOCAL1", "LOCAL2", "LOCAL3", "LOCAL4", "LOCAL5", "LOCAL6", "LOCAL7"}},
+	{Name: "Tag", Type: ValueString, Since: "9.4"},
+	{Name: "TCPKeepAlive", Type: ValueFlag},
+	{Name: "Tunnel", Type: ValueEnum, Values: []string{"yes", "point-to-point", "ethernet", "no", "true", "false"}},
+	{Name: "TunnelDevice", Type: ValueString},
+	{Name: "UpdateHostKeys", Type: ValueEnum, Values: []string{"yes", "no", "ask", "true", "false"}, Since: "6.8"},
+	{Name: "UseKeychain", Type: ValueFlag},
+	{Name: "UsePrivilegedPort", Type: ValueFlag, Deprecated: "7.5"},
+	{Name: "User", Type: ValueString},
+	{Name: "UserKnownHostsFile", Type: ValuePathList, Values: []string{"none"}},
+	{Name: "UseRoaming", Type: ValueFlag, Deprecated: "7.2"},
+	{Name: "VerifyHostKeyDNS", Type: ValueEnum, Values: []string{"yes", "ask", "no", "true", "false"}},
+	{Name: "VisualHostKey", Type: ValueFlag},
+	{Name: "XAuthLocation", Type: ValuePath},
+}
+
+// keywordIndex maps lowercased keyword names and aliases to their index in
+// keywords.
+var keywordIndex = make(map[string]int, len(keywords))
+
+func init() {
+	sort.Slice(keywords, func(i, j int) bool {
+		return strings.ToLower(keywords[i].Name) < strings.ToLower(keywords[j].Name)
+	})
+	for i := range keywords {
+		kw := &keywords[i]
+		lkey := strings.ToLower(kw.Name)
+		keywordIndex[lkey] = i
+		for _, alias := range kw.Aliases {
+			keywordIndex[strings.ToLower(alias)] = i
+		}
+		kw.Multiple = pluralDirectives[lkey]
+		kw.Tokens = allowedTokens[lkey]
+		kw.Env = envKeywords[lkey]
+		kw.Tilde = tildeKeywords[lkey]
+		kw.Default = defaults[lkey]
+	}
+}
+
+// canonicalKey returns the lowercased name of the keyword that key refers to,
+// so that an obsolete alias such as PubkeyAcceptedKeyTypes is stored with the
+// current name. Unknown keywords are lowercased.
+func canonicalKey(key string) string {
+	lkey := strings.ToLower(key)
+	if i, ok := keywordIndex[lkey]; ok {
+		return strings.ToLower(keywords[i].Name)
+	}
+	return lkey
+}
+
+// copy returns kw with its own copies of the slices, so that callers cannot
+// modify the catalog.
+func (kw Keyword) copy() Keyword {
+	kw.Values = append([]string(nil), kw.Values...)
+	kw.Aliases = append([]string(nil), kw.Aliases...)
+	return kw
+}
+
+// Keywords returns every keyword that ssh_config(5) documents, along with a
+// few obsolete ones that have a non-empty Deprecated field, sorted by name.
+// Host and Match are not included.
+func Keywords() []Keyword {
+	all := make([]Keyword, len(keywords))
+	for i := range keywords {
+		all[i] = keywords[i].copy()
+	}
+	return all
+}
+
+// LookupKeyword returns the Keyword for name, which may be an alias. The
+// match is case insensitive. LookupKeyword reports false if name is not a
+// known keyword.
+func LookupKeyword(name string) (Keyword, bool) {
+	i, ok := keywordIndex[strings.ToLower(name)]
+	if !ok {
+		return Keyword{}, false
+	}
+	return keywords[i].copy(), true
+}
@@ -0,0 +1,120 @@
+package ssh_config
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestKeywordsSorted(t *testing.T) {
+	kws := Keywords()
+	if len(kws) < 100 {
+		t.Errorf("got %d keywords, want at least 100", len(kws))
+	}
+	if !sort.SliceIsSorted(kws, func(i, j int) bool {
+		return strings.ToLower(kws[i].Name) < strings.ToLower(kws[j].Name)
+	}) {
+		t.Error("Keywords() is not sorted by name")
+	}
+	seen := make(map[string]bool)
+	for _, kw := range kws {
+		if seen[strings.ToLower(kw.Name)] {
+			t.Errorf("%s is listed twice", kw.Name)
+		}
+		seen[strings.ToLower(kw.Name)] = true
+		if kw.Type == ValueEnum && len(kw.Values) == 0 {
+			t.Errorf("%s: enum with no values", kw.Name)
+		}
+	}
+}
+
+func TestLookupKeyword(t *testing.T) {
+	kw, ok := LookupKeyword("identityfile")
+	if !ok {
+		t.Fatal("IdentityFile not found")
+	}
+	if kw.Name != "IdentityFile" || kw.Type != ValuePath || !kw.Multiple || !kw.Env || !kw.Tilde || kw.Tokens != defaultTokens {
+		t.Errorf("IdentityFile: got %+v", kw)
+	}
+
+	kw, ok = LookupKeyword("PubkeyAcceptedKeyTypes")
+	if !ok || kw.Name != "PubkeyAcceptedAlgorithms" || kw.Type != ValueAlgorithms || kw.Since != "8.5" {
+		t.Errorf("PubkeyAcceptedKeyTypes: got %+v, %t", kw, ok)
+	}
+	if kw.Default != defaultPKAlg {
+		t.Errorf("PubkeyAcceptedAlgorithms: got default %q", kw.Default)
+	}
+
+	kw, ok = LookupKeyword("Port")
+	if !ok || kw.Type != ValueUint || kw.Default != "22" || kw.Multiple {
+		t.Errorf("Port: got %+v, %t", kw, ok)
+	}
+
+	kw, ok = LookupKeyword("UseRoaming")
+	if !ok || kw.Deprecated == "" {
+		t.Errorf("UseRoaming: got %+v, %t", kw, ok)
+	}
+
+	if _, ok := LookupKeyword("Host"); ok {
+		t.Error("Host should not be in the catalog")
+	}
+	if _, ok := LookupKeyword("NotAKeyword"); ok {
+		t.Error("NotAKeyword should not be in the catalog")
+	}
+}
+
+func TestKeywordsCopy(t *testing.T) {
+	kw, _ := LookupKeyword("LogLevel")
+	kw.Values[0] = "changed"
+	kw, _ = LookupKeyword("LogLevel")
+	if kw.Values[0] != "QUIET" {
+		t.Errorf("modifying the result changed the catalog: %v", kw.Values)
+	}
+}
+
+// The catalog should agree with the tables used for expansion and dumping.
+func TestKeywordsConsistent(t *testing.T) {
+	check := func(table string, lkey string) Keyword {
+		t.Helper()
+		kw, ok := LookupKeyword(lkey)
+		if !ok {
+			t.Errorf("%s: %q is not in the catalog", table, lkey)
+		}
+		return kw
+	}
+	for lkey := range valueCheckers {
+		check("valueCheckers", lkey)
+	}
+	for lkey := range defaults {
+		check("defaults", lkey)
+	}
+	for lkey := range pluralDirectives {
+		check("pluralDirectives", lkey)
+	}
+	for lkey := range allowedTokens {
+		if lkey != matchExecKeyword {
+			check("allowedTokens", lkey)
+		}
+	}
+	for lkey := range envKeywords {
+		check("envKeywords", lkey)
+	}
+	for lkey := range tildeKeywords {
+		check("tildeKeywords", lkey)
+	}
+	for _, lkey := range dumpOrder {
+		check("dumpOrder", lkey)
+	}
+	for lkey := range dumpTimes {
+		if kw := check("dumpTimes", lkey); kw.Type != ValueDuration {
+			t.Errorf("%s: got type %s, want duration", kw.Name, kw.Type)
+		}
+	}
+	for _, kw := range keywords {
+		for _, alias := range kw.Aliases {
+			if got := canonicalKey(alias); got != strings.ToLower(kw.Name) {
+				t.Errorf("canonicalKey(%s): got %s, want %s", alias, got, strings.ToLower(kw.Name))
+			}
+		}
+	}
+}
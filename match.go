@@ -0,0 +1,604 @@
+package ssh_config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	osuser "os/user"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	// FirstPass is the pass number for the first time the configuration is
+	// read.
+	FirstPass = 1
+	// FinalPass is the pass number when the configuration is read again after
+	// hostname canonicalization, or because a "Match final" block requested
+	// it. "Match canonical" and "Match final" blocks only apply in this pass.
+	FinalPass = 2
+)
+
+// MatchContext holds the values that Host and Match blocks are evaluated
+// against.
+type MatchContext struct {
+	// OriginalHost is the host name as it was given on the command line. It is
+	// matched by "Match originalhost".
+	OriginalHost string
+	// Host is the host name that is matched by "Host" and "Match host". If
+	// Host is empty, OriginalHost is used.
+	Host string
+	// RemoteUser is the user to log in as on the remote host, if it was
+	// specified outside of the configuration (e.g. with "ssh -l"). It is
+	// matched by "Match user". If RemoteUser is empty, the User set in the
+	// configuration is used, falling back to LocalUser.
+	RemoteUser string
+	// LocalUser is the name of the local user. It is matched by "Match
+	// localuser".
+	LocalUser string
+	// UID, HomeDir and LocalHostname describe the local user and machine.
+	// They are only used to expand the %i, %d, %l and %L tokens in "Match
+	// exec" commands.
+	UID           string
+	HomeDir       string
+	LocalHostname string
+	// Tag is matched by "Match tagged", like the tag given with "ssh -P". If
+	// Tag is empty, the Tag set in the configuration is used.
+	Tag string
+	// SessionType is matched by "Match sessiontype": "shell", "exec",
+	// "subsystem" or "none". If SessionType is empty, the SessionType set in
+	// the configuration is used. If that is unset or "default", the session
+	// type is "exec" if there is a Command and "shell" otherwise.
+	SessionType string
+	// Command is the remote command, or the subsystem name for a
+	// "subsystem" session. It is matched by "Match command". If Command is
+	// empty, the RemoteCommand set in the configuration is used.
+	Command string
+	// Pass is FirstPass or FinalPass. Zero is treated as FirstPass.
+	Pass int
+	// Resolver is used to look up host names for hostname canonicalization
+	// before the final pass. If Resolver is nil, net.DefaultResolver is used.
+	Resolver Resolver
+	// Executor runs the command for "Match exec" criteria. If Executor is
+	// nil, commands are never run and Match blocks with an exec criterion do
+	// not apply.
+	Executor Executor
+	// InterfaceAddrs returns the addresses of the local network interfaces,
+	// which "Match localnetwork" is evaluated against. If InterfaceAddrs is
+	// nil, net.InterfaceAddrs is used.
+	InterfaceAddrs func() ([]net.Addr, error)
+
+	// matchHost is the HostName set so far while resolving a host, which
+	// "Match host" is evaluated against instead of Host.
+	matchHost string
+	// port and jumpHost are the Port and ProxyJump set so far while
+	// resolving a host, for expanding tokens in "Match exec" commands.
+	port     string
+	jumpHost string
+}
+
+var (
+	localOnce sync.Once
+	local     TokenContext
+)
+
+// localTokens returns the current user and hostname. They are looked up once,
+// and values that cannot be found are left empty.
+func localTokens() TokenContext {
+	localOnce.Do(func() {
+		if u, err := osuser.Current(); err == nil {
+			local.LocalUser = u.Username
+			local.UID = u.Uid
+			local.HomeDir = u.HomeDir
+		}
+		if hostname, err := os.Hostname(); err == nil {
+			local.LocalHostname = hostname
+		}
+	})
+	return local
+}
+
+// NewMatchContext returns a MatchContext for the first pass over the
+// configuration for alias, with LocalUser, UID, HomeDir and LocalHostname set
+// from the current user and hostname.
+func NewMatchContext(alias string) *MatchContext {
+	tc := localTokens()
+	return &MatchContext{
+		OriginalHost:  alias,
+		LocalUser:     tc.LocalUser,
+		UID:           tc.UID,
+		HomeDir:       tc.HomeDir,
+		LocalHostname: tc.LocalHostname,
+		Pass:          FirstPass,
+	}
+}
+
+func (m *MatchContext) host() string {
+	if m.Host != "" {
+		return m.Host
+	}
+	return m.OriginalHost
+}
+
+func (m *MatchContext) sessionType() string {
+	if m.SessionType != "" && !strings.EqualFold(m.SessionType, "default") {
+		return strings.ToLower(m.SessionType)
+	}
+	if m.Command != "" {
+		return "exec"
+	}
+	return "shell"
+}
+
+func (m *MatchContext) remoteUser() string {
+	if m.RemoteUser != "" {
+		return m.RemoteUser
+	}
+	return m.LocalUser
+}
+
+// matchPatterns reports whether s matches at least one of patterns, and none
+// of the negated patterns.
+func matchPatterns(patterns []*Pattern, s string) bool {
+	found := false
+	for i := range patterns {
+		if patterns[i].regex.MatchString(s) {
+			if patterns[i].not {
+				// Negated match. "A pattern entry may be negated by prefixing
+				// it with an exclamation mark (`!'). If a negated entry is
+				// matched, then the Host entry is ignored, regardless of
+				// whether any other patterns on the line match. Negated matches
+				// are therefore useful to provide exceptions for wildcard
+				// matches."
+				return false
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+// MatchCriterion is a single criterion on a Match line, such as "user deploy"
+// or "!canonical". All of the criteria on a Match line must match for the
+// block to apply.
+type MatchCriterion struct {
+	// Keyword is the name of the criterion as it appeared in the file, e.g.
+	// "Host" or "user", without any leading "!".
+	Keyword string
+	// Negated is true if the criterion was prefixed with "!", in which case
+	// the criterion matches if the underlying test does not.
+	Negated bool
+	// Patterns is the pattern-list for criteria that take one, such as "host"
+	// and "user". A pattern-list may be written as several comma-separated
+	// patterns.
+	Patterns []*Pattern
+	// Command is the command for an "exec" criterion, without surrounding
+	// quotes. Percent tokens in Command are expanded before it is run.
+	Command string
+
+	// text is the argument as it appeared in the file, so String can print it
+	// back unchanged. It is only used while Patterns still holds parsed and
+	// Command still holds the command from text.
+	text   string
+	parsed []*Pattern
+	// networks is the CIDR list for a "localnetwork" criterion.
+	networks []network
+}
+
+// criteriaWithoutArgs are Match criteria that do not take an argument.
+var criteriaWithoutArgs = map[string]bool{
+	"all":       true,
+	"canonical": true,
+	"final":     true,
+}
+
+// criteriaWithPatterns are Match criteria that take a list of patterns.
+var criteriaWithPatterns = map[string]bool{
+	"host":         true,
+	"originalhost": true,
+	"user":         true,
+	"localuser":    true,
+	"tagged":       true,
+	"sessiontype":  true,
+	"command":      true,
+}
+
+// singleArgCriteria are pattern criteria that take a single argument, rather
+// than every word up to the next criterion.
+var singleArgCriteria = map[string]bool{
+	"sessiontype": true,
+	"command":     true,
+}
+
+// isCriterion reports whether word, with an optional leading "!", names a
+// Match criterion.
+func isCriterion(word string) bool {
+	name := strings.ToLower(strings.TrimPrefix(word, "!"))
+	return criteriaWithoutArgs[name] || criteriaWithPatterns[name] ||
+		name == "exec" || name == "localnetwork"
+}
+
+// network is a single entry in the address list for "Match localnetwork".
+type network struct {
+	ipnet *net.IPNet
+	not   bool
+}
+
+// parseNetworkList parses the arguments for a localnetwork criterion. Each
+// argument may hold several comma-separated networks in CIDR notation, or
+// single addresses, optionally negated with "!".
+func parseNetworkList(args []string) ([]network, error) {
+	networks := make([]network, 0, len(args))
+	for _, arg := range args {
+		for _, s := range strings.Split(arg, ",") {
+			if s == "" {
+				continue
+			}
+			var n network
+			if s[0] == '!' {
+				n.not = true
+				s = s[1:]
+			}
+			if !strings.Contains(s, "/") {
+				ip := net.ParseIP(s)
+				if ip == nil {
+					return nil, fmt.Errorf("invalid address %q", s)
+				}
+				bits := 8 * net.IPv6len
+				if ip4 := ip.To4(); ip4 != nil {
+					ip = ip4
+					bits = 8 * net.IPv4len
+				}
+				n.ipnet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+			} else {
+				_, ipnet, err := net.ParseCIDR(s)
+				if err != nil {
+					return nil, err
+				}
+				n.ipnet = ipnet
+			}
+			networks = append(networks, n)
+		}
+	}
+	return networks, nil
+}
+
+// matchNetworks reports whether at least one of addrs is in one of networks,
+// and none of addrs is in a negated network.
+func matchNetworks(networks []network, addrs []net.Addr) bool {
+	found := false
+	for _, addr := range addrs {
+		var ip net.IP
+		switch a := addr.(type) {
+		case *net.IPNet:
+			ip = a.IP
+		case *net.IPAddr:
+			ip = a.IP
+		default:
+			continue
+		}
+		for _, n := range networks {
+			if n.ipnet.Contains(ip) {
+				if n.not {
+					return false
+				}
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// splitMatchArgs splits the arguments to a Match directive on whitespace,
+// keeping double-quoted strings such as an exec command together. The quotes
+// are kept in the returned fields.
+func splitMatchArgs(s string) ([]string, error) {
+	var fields []string
+	var buf strings.Builder
+	inQuote := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			buf.WriteRune(r)
+		case !inQuote && unicode.IsSpace(r):
+			if buf.Len() > 0 {
+				fields = append(fields, buf.String())
+				buf.Reset()
+			}
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	if inQuote {
+		return nil, errors.New("ssh_config: unterminated quote in Match directive")
+	}
+	if buf.Len() > 0 {
+		fields = append(fields, buf.String())
+	}
+	return fields, nil
+}
+
+// unquote removes a pair of surrounding double quotes from s.
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// parsePatternList parses the arguments for a criterion. Each argument may hold
+// several comma-separated patterns.
+func parsePatternList(args []string) ([]*Pattern, error) {
+	patterns := make([]*Pattern, 0, len(args))
+	for _, arg := range args {
+		for _, s := range strings.Split(unquote(arg), ",") {
+			if s == "" {
+				continue
+			}
+			pat, err := NewPattern(s)
+			if err != nil {
+				return nil, err
+			}
+			patterns = append(patterns, pat)
+		}
+	}
+	return patterns, nil
+}
+
+func samePatterns(a, b []*Pattern) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// String prints c as it appeared on the Match line.
+func (c *MatchCriterion) String() string {
+	var buf strings.Builder
+	if c.Negated {
+		buf.WriteByte('!')
+	}
+	buf.WriteString(c.Keyword)
+	isExec := strings.EqualFold(c.Keyword, "exec")
+	if c.text != "" && samePatterns(c.Patterns, c.parsed) && (!isExec || c.Command == unquote(c.text)) {
+		buf.WriteByte(' ')
+		buf.WriteString(c.text)
+	} else if isExec {
+		buf.WriteByte(' ')
+		if c.Command == "" || strings.ContainsAny(c.Command, " \t") {
+			buf.WriteString(`"` + c.Command + `"`)
+		} else {
+			buf.WriteString(c.Command)
+		}
+	} else if len(c.Patterns) > 0 {
+		buf.WriteByte(' ')
+		for i, pat := range c.Patterns {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(pat.String())
+		}
+	}
+	return buf.String()
+}
+
+// Matches reports whether c matches the values in ctx, taking Negated into
+// account. An exec criterion does not match if ctx.Executor is nil, even if it
+// is negated, or if the command could not be run.
+func (c *MatchCriterion) Matches(ctx *MatchContext) bool {
+	ok, err := c.match(ctx)
+	return ok && err == nil
+}
+
+func (c *MatchCriterion) match(ctx *MatchContext) (bool, error) {
+	if ctx.Executor == nil && strings.EqualFold(c.Keyword, "exec") {
+		// The command can't be run, so neither "exec" nor "!exec" applies.
+		return false, nil
+	}
+	result, err := c.test(ctx)
+	if err != nil {
+		return false, err
+	}
+	return result != c.Negated, nil
+}
+
+func (c *MatchCriterion) test(ctx *MatchContext) (bool, error) {
+	switch strings.ToLower(c.Keyword) {
+	case "all":
+		return true, nil
+	case "canonical", "final":
+		return ctx.Pass == FinalPass, nil
+	case "exec":
+		return c.exec(ctx)
+	case "localnetwork":
+		interfaceAddrs := ctx.InterfaceAddrs
+		if interfaceAddrs == nil {
+			interfaceAddrs = net.InterfaceAddrs
+		}
+		addrs, err := interfaceAddrs()
+		if err != nil {
+			return false, fmt.Errorf("ssh_config: Match localnetwork: %v", err)
+		}
+		return matchNetworks(c.networks, addrs), nil
+	}
+	if subject, ok := c.subject(ctx); ok {
+		return matchPatterns(c.Patterns, subject), nil
+	}
+	return false, nil
+}
+
+// subject returns the value in ctx that c's patterns are matched against, or
+// false if c does not take a pattern-list.
+func (c *MatchCriterion) subject(ctx *MatchContext) (string, bool) {
+	switch strings.ToLower(c.Keyword) {
+	case "host":
+		if ctx.matchHost != "" {
+			return ctx.matchHost, true
+		}
+		return ctx.host(), true
+	case "originalhost":
+		return ctx.OriginalHost, true
+	case "user":
+		return ctx.remoteUser(), true
+	case "localuser":
+		return ctx.LocalUser, true
+	case "tagged":
+		return ctx.Tag, true
+	case "sessiontype":
+		return ctx.sessionType(), true
+	case "command":
+		return ctx.Command, true
+	}
+	return "", false
+}
+
+// exec expands the tokens in the command for an exec criterion and runs it
+// with ctx.Executor.
+func (c *MatchCriterion) exec(ctx *MatchContext) (bool, error) {
+	if ctx.Executor == nil {
+		return false, nil
+	}
+	tc := TokenContext{
+		LocalUser:     ctx.LocalUser,
+		UID:           ctx.UID,
+		HomeDir:       ctx.HomeDir,
+		LocalHostname: ctx.LocalHostname,
+		OriginalHost:  ctx.OriginalHost,
+		Host:          ctx.host(),
+		RemoteUser:    ctx.remoteUser(),
+		Port:          ctx.port,
+		JumpHost:      ctx.jumpHost,
+	}
+	if ctx.matchHost != "" {
+		tc.Host = ctx.matchHost
+	}
+	if tc.Port == "" {
+		tc.Port = Default("Port")
+	}
+	cmd, err := ExpandTokens(matchExecKeyword, c.Command, &tc)
+	if err != nil {
+		return false, err
+	}
+	ok, err := ctx.Executor.Exec(cmd)
+	if err != nil {
+		return false, fmt.Errorf("ssh_config: Match exec %q: %v", cmd, err)
+	}
+	return ok, nil
+}
+
+// parseCriterion returns the criterion for word, which may start with "!",
+// and its arguments as they appeared on the Match line.
+func parseCriterion(word string, args []string) (*MatchCriterion, error) {
+	keyword := strings.TrimPrefix(word, "!")
+	criterion := strings.ToLower(keyword)
+	c := &MatchCriterion{Keyword: keyword, Negated: strings.HasPrefix(word, "!")} // preserve original case
+	switch {
+	case criteriaWithoutArgs[criterion]:
+		if len(args) > 0 {
+			return nil, fmt.Errorf("ssh_config: Match %s does not take an argument", keyword)
+		}
+	case criteriaWithPatterns[criterion], criterion == "localnetwork":
+		if len(args) == 0 {
+			// Match Host requires at least one pattern, e.g. "Match Host
+			// *.example.com".
+			return nil, fmt.Errorf("ssh_config: Match %s requires at least one pattern", keyword)
+		}
+		if criterion == "localnetwork" {
+			networks, err := parseNetworkList(args)
+			if err != nil {
+				return nil, fmt.Errorf("ssh_config: invalid localnetwork network: %v", err)
+			}
+			c.networks = networks
+		} else {
+			patterns, err := parsePatternList(args)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s pattern: %w", criterion, err)
+			}
+			c.Patterns = patterns
+			c.parsed = patterns
+		}
+		c.text = strings.Join(args, " ")
+	case criterion == "exec":
+		// Match Exec runs arbitrary commands, so it is parsed but only
+		// evaluated if the caller provides an Executor.
+		if len(args) != 1 {
+			return nil, fmt.Errorf("ssh_config: Match %s requires a command", keyword)
+		}
+		c.text = args[0]
+		c.Command = unquote(args[0])
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedMatch, criterion)
+	}
+	return c, nil
+}
+
+// checkMatchAll returns an error if "all" is combined with other criteria.
+// As in ssh, "all" may only appear alone or after "canonical" or "final".
+func checkMatchAll(criteria []*MatchCriterion) error {
+	for i, c := range criteria {
+		if !strings.EqualFold(c.Keyword, "all") {
+			continue
+		}
+		last := i == len(criteria)-1
+		afterPass := i == 1 && (strings.EqualFold(criteria[0].Keyword, "canonical") ||
+			strings.EqualFold(criteria[0].Keyword, "final"))
+		if !last || (i > 0 && !afterPass) {
+			return errors.New("ssh_config: Match all cannot be combined with other criteria")
+		}
+	}
+	return nil
+}
+
+// matchPatternsFor returns the value of Host.Patterns for a Match line with
+// criteria: the patterns for a lone "host" criterion, a pattern that matches
+// everything for "Match all", and nil otherwise.
+func matchPatternsFor(criteria []*MatchCriterion) []*Pattern {
+	if len(criteria) != 1 || criteria[0].Negated {
+		return nil
+	}
+	switch strings.ToLower(criteria[0].Keyword) {
+	case "all":
+		// "Match all" is equivalent to "Host *" — matches everything.
+		return []*Pattern{matchAll}
+	case "host":
+		return criteria[0].Patterns
+	}
+	return nil
+}
+
+// matchCriteria reports whether every criterion matches ctx, and explains the
+// result. As in ssh, the criteria are evaluated in order and evaluation stops
+// at the first criterion that does not match, so exec commands only run if
+// every criterion before them matched. If ctx.Executor is nil, a block with an
+// exec criterion never matches.
+func matchCriteria(criteria []*MatchCriterion, ctx *MatchContext) (bool, string, error) {
+	if ctx.Executor == nil {
+		for _, c := range criteria {
+			if strings.EqualFold(c.Keyword, "exec") {
+				return false, fmt.Sprintf("criterion %q was not run: no Executor is set", c.String()), nil
+			}
+		}
+	}
+	for _, c := range criteria {
+		ok, err := c.match(ctx)
+		if err != nil {
+			return false, "", err
+		}
+		if ok {
+			continue
+		}
+		if subject, ok := c.subject(ctx); ok {
+			return false, fmt.Sprintf("criterion %q does not match %q", c.String(), subject), nil
+		}
+		return false, fmt.Sprintf("criterion %q does not match", c.String()), nil
+	}
+	return true, "all criteria match", nil
+}
@@ -1,6 +1,11 @@
 package ssh_config
 
 import (
+	"bytes"
+	"errors"
+	"net"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
 )
@@ -360,83 +365,37 @@ Match Host *.example.com
 
 func TestMatchUnsupportedCriteria(t *testing.T) {
 	// Every Match criterion from the ssh_config manpage that we don't
-	// support, plus case variations and the special Exec case.
+	// support, plus malformed exec criteria.
 	tests := []struct {
 		name    string
 		config  string
 		wantErr string
 	}{
-		// Exec gets its own error message because it's a security concern.
 		{
-			name:    "exec lowercase",
-			config:  "Match exec \"echo hello\"\n    Port 22",
-			wantErr: "ssh_config: Match Exec is not supported",
+			name:    "exec without command",
+			config:  "Match exec\n    Port 22",
+			wantErr: "ssh_config: Match exec requires a command",
 		},
 		{
-			name:    "exec uppercase",
-			config:  "Match EXEC \"echo hello\"\n    Port 22",
-			wantErr: "ssh_config: Match Exec is not supported",
-		},
-		{
-			name:    "exec mixed case",
-			config:  "Match ExEc \"echo hello\"\n    Port 22",
-			wantErr: "ssh_config: Match Exec is not supported",
-		},
-		{
-			name:    "exec with complex command",
-			config:  "Match Exec \"test -f /etc/ssh/flag\"\n    Port 22",
-			wantErr: "ssh_config: Match Exec is not supported",
+			name:    "exec unterminated quote",
+			config:  "Match Exec \"test -f /etc/ssh/flag\n    Port 22",
+			wantErr: "ssh_config: unterminated quote in Match directive",
 		},
 		// All other unsupported criteria.
 		{
-			name:    "user",
-			config:  "Match User admin\n    Port 22",
-			wantErr: "ssh_config: unsupported Match criterion",
+			name:    "localnetwork with no networks",
+			config:  "Match LocalNetwork\n    Port 22",
+			wantErr: "ssh_config: Match LocalNetwork requires at least one pattern",
 		},
 		{
-			name:    "user uppercase",
-			config:  "Match USER admin\n    Port 22",
-			wantErr: "ssh_config: unsupported Match criterion",
+			name:    "localnetwork invalid network",
+			config:  "Match localnetwork 10.0.0.0/33\n    Port 22",
+			wantErr: `ssh_config: invalid localnetwork network: invalid CIDR address: 10.0.0.0/33`,
 		},
 		{
-			name:    "localuser",
-			config:  "Match LocalUser kevin\n    Port 22",
-			wantErr: "ssh_config: unsupported Match criterion",
-		},
-		{
-			name:    "localuser uppercase",
-			config:  "Match LOCALUSER kevin\n    Port 22",
-			wantErr: "ssh_config: unsupported Match criterion",
-		},
-		{
-			name:    "originalhost",
-			config:  "Match OriginalHost *.example.com\n    Port 22",
-			wantErr: "ssh_config: unsupported Match criterion",
-		},
-		{
-			name:    "originalhost uppercase",
-			config:  "Match ORIGINALHOST *.example.com\n    Port 22",
-			wantErr: "ssh_config: unsupported Match criterion",
-		},
-		{
-			name:    "canonical",
-			config:  "Match canonical\n    Port 22",
-			wantErr: "ssh_config: unsupported Match criterion",
-		},
-		{
-			name:    "final",
-			config:  "Match final\n    Port 22",
-			wantErr: "ssh_config: unsupported Match criterion",
-		},
-		{
-			name:    "tagged",
-			config:  "Match Tagged mytag\n    Port 22",
-			wantErr: "ssh_config: unsupported Match criterion",
-		},
-		{
-			name:    "localnetwork",
-			config:  "Match LocalNetwork 192.168.1.0/24\n    Port 22",
-			wantErr: "ssh_config: unsupported Match criterion",
+			name:    "localnetwork hostname",
+			config:  "Match localnetwork example.com\n    Port 22",
+			wantErr: `ssh_config: invalid localnetwork network: invalid address "example.com"`,
 		},
 		{
 			name:    "completely bogus criterion",
@@ -455,6 +414,31 @@ func TestMatchUnsupportedCriteria(t *testing.T) {
 			config:  "Match Host   \n    Port 22",
 			wantErr: "ssh_config: Match Host requires at least one pattern",
 		},
+		{
+			name:    "match user with no patterns",
+			config:  "Match User\n    Port 22",
+			wantErr: "ssh_config: Match User requires at least one pattern",
+		},
+		{
+			name:    "match canonical with argument",
+			config:  "Match canonical yes\n    Port 22",
+			wantErr: `ssh_config: unsupported Match criterion "yes"`,
+		},
+		{
+			name:    "match all combined with host",
+			config:  "Match host foo all\n    Port 22",
+			wantErr: "ssh_config: Match all cannot be combined with other criteria",
+		},
+		{
+			name:    "match all before other criteria",
+			config:  "Match all user root\n    Port 22",
+			wantErr: "ssh_config: Match all cannot be combined with other criteria",
+		},
+		{
+			name:    "negated criterion with no keyword",
+			config:  "Match !\n    Port 22",
+			wantErr: `ssh_config: unsupported Match criterion ""`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -537,6 +521,12 @@ func TestMatchStringRoundTrip(t *testing.T) {
 			name: "match All mixed case round-trip",
 			config: `Match All
     Port 4567
+`,
+		},
+		{
+			name: "multiple criteria",
+			config: `Match Host *.example.com,*.example.org !user root canonical
+    Port 2222
 `,
 		},
 		{
@@ -573,6 +563,8 @@ func TestMatchFileRoundTrip(t *testing.T) {
 		"testdata/match-all",
 		"testdata/match-mixed",
 		"testdata/match-host-negation",
+		"testdata/match-criteria",
+		"testdata/match-tagged",
 	} {
 		data := loadFile(t, filename)
 		cfg, err := Decode(strings.NewReader(string(data)))
@@ -597,3 +589,481 @@ func TestMatchExistingDirectiveFile(t *testing.T) {
 		t.Errorf("expected Port=4567 via Match all, got %q", val)
 	}
 }
+
+func TestMatchCriteria(t *testing.T) {
+	data := loadFile(t, "testdata/match-criteria")
+	cfg, err := Decode(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		ctx  MatchContext
+		key  string
+		want string
+	}{
+		{"user from context", MatchContext{OriginalHost: "web", RemoteUser: "deploy"}, "Port", "2201"},
+		{"user falls back to local user", MatchContext{OriginalHost: "web", LocalUser: "deploy"}, "Port", "2201"},
+		{"user set by config", MatchContext{OriginalHost: "db", LocalUser: "kevin"}, "Port", "2201"},
+		{"localuser", MatchContext{OriginalHost: "web", LocalUser: "kevin"}, "Port", "2202"},
+		{"originalhost", MatchContext{OriginalHost: "jump.example.com"}, "Port", "2203"},
+		{"originalhost ignores Host", MatchContext{OriginalHost: "x", Host: "jump.example.com"}, "Port", ""},
+		{"tagged", MatchContext{OriginalHost: "web", Tag: "bastion"}, "ProxyJump", "bastion.example.com"},
+		{"tagged no match", MatchContext{OriginalHost: "web", Tag: "direct"}, "ProxyJump", ""},
+		{"canonical first pass", MatchContext{OriginalHost: "web"}, "Compression", ""},
+		{"canonical final pass", MatchContext{OriginalHost: "web", Pass: FinalPass}, "Compression", "yes"},
+		{"final pass", MatchContext{OriginalHost: "web", Pass: FinalPass}, "ForwardAgent", "yes"},
+		{"host uses HostName", MatchContext{OriginalHost: "db"}, "IdentityFile", "~/.ssh/internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			r, err := cfg.ResolveContext(&ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.Get(tt.key); got != tt.want {
+				t.Errorf("Get(%q): got %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchCriteriaRoundTrip(t *testing.T) {
+	data := loadFile(t, "testdata/match-criteria")
+	cfg, err := Decode(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.String(); got != string(data) {
+		t.Errorf("round-trip mismatch:\ngot:\n%s\nwant:\n%s", got, string(data))
+	}
+}
+
+func TestMatchMultipleCriteria(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		ctx    MatchContext
+		want   string
+	}{
+		{
+			name:   "host and negated user match",
+			config: "Match host *.prod !user root\n    Port 2222",
+			ctx:    MatchContext{OriginalHost: "web.prod", LocalUser: "deploy"},
+			want:   "2222",
+		},
+		{
+			name:   "negated user vetoes",
+			config: "Match host *.prod !user root\n    Port 2222",
+			ctx:    MatchContext{OriginalHost: "web.prod", LocalUser: "root"},
+			want:   "",
+		},
+		{
+			name:   "host does not match",
+			config: "Match host *.prod !user root\n    Port 2222",
+			ctx:    MatchContext{OriginalHost: "web.stage", LocalUser: "deploy"},
+			want:   "",
+		},
+		{
+			name:   "comma separated pattern-list",
+			config: "Match host a.example,b.example\n    Port 2222",
+			ctx:    MatchContext{OriginalHost: "b.example"},
+			want:   "2222",
+		},
+		{
+			name:   "comma separated pattern-list with negation",
+			config: "Match host *.example,!b.example\n    Port 2222",
+			ctx:    MatchContext{OriginalHost: "b.example"},
+			want:   "",
+		},
+		{
+			name:   "negated canonical in first pass",
+			config: "Match !canonical host a.example\n    Port 2222",
+			ctx:    MatchContext{OriginalHost: "a.example"},
+			want:   "2222",
+		},
+		{
+			name:   "negated canonical in final pass",
+			config: "Match !canonical host a.example\n    Port 2222",
+			ctx:    MatchContext{OriginalHost: "a.example", Pass: FinalPass},
+			want:   "",
+		},
+		{
+			name:   "final all",
+			config: "Match final all\n    Port 2222",
+			ctx:    MatchContext{OriginalHost: "a.example", Pass: FinalPass},
+			want:   "2222",
+		},
+		{
+			name:   "three criteria",
+			config: "Match originalhost web user deploy localuser kevin\n    Port 2222",
+			ctx:    MatchContext{OriginalHost: "web", RemoteUser: "deploy", LocalUser: "kevin"},
+			want:   "2222",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Decode(strings.NewReader(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := tt.ctx
+			r, err := cfg.ResolveContext(&ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.Get("Port"); got != tt.want {
+				t.Errorf("Get(Port): got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchCriteriaFields(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Match Host a.example,b.example !User root\n    Port 2222\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := cfg.Hosts[1]
+	if len(host.Criteria) != 2 {
+		t.Fatalf("expected 2 criteria, got %d", len(host.Criteria))
+	}
+	c := host.Criteria[0]
+	if c.Keyword != "Host" || c.Negated || len(c.Patterns) != 2 {
+		t.Errorf("unexpected first criterion: %+v", c)
+	}
+	c = host.Criteria[1]
+	if c.Keyword != "User" || !c.Negated || len(c.Patterns) != 1 || c.Patterns[0].String() != "root" {
+		t.Errorf("unexpected second criterion: %+v", c)
+	}
+	if host.Patterns != nil {
+		t.Errorf("expected nil Patterns for a Match line with several criteria, got %v", host.Patterns)
+	}
+
+	// Changing the patterns changes the printed output.
+	pat, err := NewPattern("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Patterns = []*Pattern{c.Patterns[0], pat}
+	want := "Match Host a.example,b.example !User root,admin\n    Port 2222\n"
+	if got := cfg.String(); got != want {
+		t.Errorf("String(): got %q, want %q", got, want)
+	}
+}
+
+// recordingExecutor records every command it is asked to run and reports
+// success for the commands in ok.
+type recordingExecutor struct {
+	ok   map[string]bool
+	err  error
+	cmds []string
+}
+
+func (e *recordingExecutor) Exec(command string) (bool, error) {
+	e.cmds = append(e.cmds, command)
+	return e.ok[command], e.err
+}
+
+func TestMatchExec(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(`Host db
+    HostName db.example.com
+    Port 2200
+
+Match exec "test-vpn %h %p %n" user deploy
+    User vpn
+
+Match !exec on-laptop
+    IdentityFile ~/.ssh/desktop
+
+Match host nope exec "never-run"
+    Port 1
+
+Match all
+    User deploy
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exe := &recordingExecutor{ok: map[string]bool{"test-vpn db.example.com 2200 db": true}}
+	ctx := NewMatchContext("db")
+	ctx.RemoteUser = "deploy"
+	ctx.Executor = exe
+	r, err := cfg.ResolveContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.User(); got != "vpn" {
+		t.Errorf("User: got %q, want vpn", got)
+	}
+	if got := r.Get("IdentityFile"); got != "~/.ssh/desktop" {
+		t.Errorf("IdentityFile: got %q", got)
+	}
+	want := []string{"test-vpn db.example.com 2200 db", "on-laptop"}
+	if !reflect.DeepEqual(exe.cmds, want) {
+		t.Errorf("commands: got %q, want %q", exe.cmds, want)
+	}
+
+	// Without an Executor, blocks with an exec criterion never apply, even
+	// if the criterion is negated.
+	r, err = cfg.Resolve("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.User(); got != "deploy" {
+		t.Errorf("User without Executor: got %q, want deploy", got)
+	}
+	if r.Has("IdentityFile") {
+		t.Errorf("expected no IdentityFile without Executor, got %q", r.Get("IdentityFile"))
+	}
+
+	exe = &recordingExecutor{err: errors.New("exec: not found")}
+	ctx.Executor = exe
+	_, err = cfg.ResolveContext(ctx)
+	if err == nil || err.Error() != `ssh_config: Match exec "test-vpn db.example.com 2200 db": exec: not found` {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestMatchExecCriterion(t *testing.T) {
+	c, err := NewMatchCriterion("!exec", "on-laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Matches(&MatchContext{OriginalHost: "db"}) {
+		t.Error("!exec matched without an Executor")
+	}
+
+	c, err = NewMatchCriterion("exec", "check %u %i %d %l %L %h %p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exe := &recordingExecutor{}
+	ctx := &MatchContext{
+		OriginalHost:  "db",
+		LocalUser:     "me",
+		UID:           "1000",
+		HomeDir:       "/home/me",
+		LocalHostname: "laptop.example.com",
+		Executor:      exe,
+	}
+	c.Matches(ctx)
+	if want := []string{"check me 1000 /home/me laptop.example.com laptop db 22"}; !reflect.DeepEqual(exe.cmds, want) {
+		t.Errorf("commands: got %q, want %q", exe.cmds, want)
+	}
+}
+
+func TestMatchExecUserSettings(t *testing.T) {
+	exe := &recordingExecutor{ok: map[string]bool{"true": true}}
+	us := &UserSettings{
+		userConfigFinder:   testConfigFinder("testdata/match-exec"),
+		systemConfigFinder: nullConfigFinder,
+		Executor:           exe,
+	}
+	if got := us.Get("example.com", "Port"); got != "2222" {
+		t.Errorf("Get(Port): got %q, want 2222", got)
+	}
+	if !reflect.DeepEqual(exe.cmds, []string{"true"}) {
+		t.Errorf("commands: got %q", exe.cmds)
+	}
+}
+
+func TestMatchExecRoundTrip(t *testing.T) {
+	data := loadFile(t, "testdata/match-exec")
+	cfg, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.String(); got != string(data) {
+		t.Errorf("round-trip mismatch:\ngot:  %q\nwant: %q", got, string(data))
+	}
+	crit := cfg.Hosts[1].Criteria[0]
+	if crit.Command != "true" {
+		t.Errorf("Command: got %q", crit.Command)
+	}
+	crit = cfg.Hosts[2].Criteria[1]
+	if crit.Command != "test -f %d/.vpn" || !crit.Negated {
+		t.Errorf("Command: got %q, negated %t", crit.Command, crit.Negated)
+	}
+	crit.Command = "on-vpn"
+	if got := crit.String(); got != "!exec on-vpn" {
+		t.Errorf("String() after changing Command: got %q", got)
+	}
+}
+
+func TestShellExecutor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	ok, err := ShellExecutor.Exec("exit 0")
+	if err != nil || !ok {
+		t.Errorf(`Exec("exit 0"): got %t, %v`, ok, err)
+	}
+	ok, err = ShellExecutor.Exec("exit 3")
+	if err != nil || ok {
+		t.Errorf(`Exec("exit 3"): got %t, %v`, ok, err)
+	}
+}
+
+func testInterfaceAddrs(cidrs ...string) func() ([]net.Addr, error) {
+	return func() ([]net.Addr, error) {
+		addrs := make([]net.Addr, 0, len(cidrs))
+		for _, cidr := range cidrs {
+			ip, ipnet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, err
+			}
+			addrs = append(addrs, &net.IPNet{IP: ip, Mask: ipnet.Mask})
+		}
+		return addrs, nil
+	}
+}
+
+func TestMatchLocalNetwork(t *testing.T) {
+	data := loadFile(t, "testdata/match-localnetwork")
+	cfg, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.String(); got != string(data) {
+		t.Errorf("round-trip mismatch:\ngot:  %q\nwant: %q", got, string(data))
+	}
+	tests := []struct {
+		name  string
+		addrs []string
+		want  string
+	}{
+		{"office", []string{"127.0.0.1/8", "192.168.1.20/24"}, "office-bastion"},
+		{"vpn", []string{"10.8.0.5/16"}, "vpn-bastion"},
+		{"vpn guest network", []string{"10.8.0.5/16", "10.99.0.2/16"}, "public-bastion"},
+		{"ipv6", []string{"fd00::1/64"}, "vpn-bastion"},
+		{"home", []string{"127.0.0.1/8", "172.16.0.4/24"}, "public-bastion"},
+	}
+	for _, tt := range tests {
+		ctx := NewMatchContext("db.example.com")
+		ctx.InterfaceAddrs = testInterfaceAddrs(tt.addrs...)
+		r, err := cfg.ResolveContext(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Get("ProxyJump"); got != tt.want {
+			t.Errorf("%s: ProxyJump: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	ctx := NewMatchContext("db.example.com")
+	ctx.InterfaceAddrs = func() ([]net.Addr, error) {
+		return nil, errors.New("no interfaces")
+	}
+	if _, err := cfg.ResolveContext(ctx); err == nil || err.Error() != "ssh_config: Match localnetwork: no interfaces" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+func TestMatchTagged(t *testing.T) {
+	data := loadFile(t, "testdata/match-tagged")
+	cfg, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		ctx  MatchContext
+		key  string
+		want string
+	}{
+		{"tag set by config", MatchContext{OriginalHost: "db.internal"}, "ProxyJump", "bastion.example.com"},
+		{"caller tag wins", MatchContext{OriginalHost: "db.internal", Tag: "direct"}, "ProxyJump", "none"},
+		{"caller tag", MatchContext{OriginalHost: "web", Tag: "bastion"}, "ProxyJump", "bastion.example.com"},
+		{"no tag", MatchContext{OriginalHost: "web"}, "ProxyJump", ""},
+		{"shell session", MatchContext{OriginalHost: "web"}, "RequestTTY", "yes"},
+		{"exec session", MatchContext{OriginalHost: "web", Command: "rsync --server ."}, "RequestTTY", "no"},
+		{"other command", MatchContext{OriginalHost: "web", Command: "uptime"}, "RequestTTY", ""},
+		{"explicit session type", MatchContext{OriginalHost: "web", SessionType: "none"}, "RequestTTY", ""},
+	}
+	for _, tt := range tests {
+		ctx := tt.ctx
+		r, err := cfg.ResolveContext(&ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.Get(tt.key); got != tt.want {
+			t.Errorf("%s: %s: got %q, want %q", tt.name, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestMatchGetUsesEarlierValues(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(`Host db
+    HostName db.internal
+    User deploy
+
+Match host *.internal
+    IdentityFile x
+
+Match user deploy
+    Port 2201
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.Resolve("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"Port": "2201", "IdentityFile": "x"} {
+		if got := r.Get(key); got != want {
+			t.Errorf("Resolve: %s: got %q, want %q", key, got, want)
+		}
+		got, err := cfg.Get("db", key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Get: %s: got %q, want %q", key, got, want)
+		}
+	}
+	all, err := cfg.GetAll("db", "IdentityFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all, []string{"x"}) {
+		t.Errorf("GetAll: IdentityFile: got %q, want [x]", all)
+	}
+	if got, _ := cfg.Get("web", "Port"); got != "" {
+		t.Errorf("Get: Port for web: got %q, want empty", got)
+	}
+}
+
+func TestMatchSessionTypeFromConfig(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(`Host backup
+    RemoteCommand rsync --server .
+
+Host tunnel
+    SessionType none
+
+Match command rsync*
+    Compression yes
+
+Match sessiontype none
+    ExitOnForwardFailure yes
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.Resolve("backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Get("Compression"); got != "yes" {
+		t.Errorf("Compression: got %q, want yes", got)
+	}
+	r, err = cfg.Resolve("tunnel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Get("ExitOnForwardFailure"); got != "yes" {
+		t.Errorf("ExitOnForwardFailure: got %q, want yes", got)
+	}
+}
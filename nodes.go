@@ -0,0 +1,164 @@
+package ssh_config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// NodeOption configures the formatting of a line created with NewKV, NewEmpty
+// or NewIncludeDirective.
+type NodeOption func(*nodeOptions)
+
+type nodeOptions struct {
+	indent  int
+	comment string
+	equals  bool
+}
+
+// WithIndent indents the line by n spaces. Keywords inside a Host or Match
+// block are conventionally indented by 4 spaces; the default is 0.
+func WithIndent(n int) NodeOption {
+	return func(o *nodeOptions) {
+		if n > 0 {
+			o.indent = n
+		}
+	}
+}
+
+// WithComment adds a comment to the end of the line, separated from the value
+// by a space. comment is written directly after the "#", so it usually starts
+// with a space, as in WithComment(" managed by onboard").
+func WithComment(comment string) NodeOption {
+	return func(o *nodeOptions) {
+		o.comment = comment
+	}
+}
+
+// WithEquals separates the keyword and value with " = " instead of a space.
+func WithEquals() NodeOption {
+	return func(o *nodeOptions) {
+		o.equals = true
+	}
+}
+
+func applyOptions(opts []NodeOption) nodeOptions {
+	var o nodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// NewConfig returns an empty Config. Keywords added to Hosts[0] apply to every
+// host, like options at the top of a config file.
+func NewConfig() *Config {
+	return newConfig()
+}
+
+// NewKV returns a KV for key and value. value is quoted if it needs to be.
+// NewKV returns an error if key is not a valid keyword, or value cannot be
+// written to a config file, for example because it contains a newline.
+func NewKV(key, value string, opts ...NodeOption) (*KV, error) {
+	if err := validKey(key); err != nil {
+		return nil, err
+	}
+	o := applyOptions(opts)
+	if strings.ContainsAny(o.comment, "\r\n") {
+		return nil, errors.New("ssh_config: comment cannot contain a newline")
+	}
+	kv := &KV{
+		Key:          key,
+		Comment:      o.comment,
+		hasEquals:    o.equals,
+		leadingSpace: o.indent,
+	}
+	if err := kv.SetValue(value); err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
+// NewEmpty returns a line containing only comment, or a blank line if comment
+// is empty. As with WithComment, comment is written directly after the "#".
+// WithComment and WithEquals have no effect.
+func NewEmpty(comment string, opts ...NodeOption) *Empty {
+	o := applyOptions(opts)
+	return &Empty{Comment: comment, leadingSpace: o.indent}
+}
+
+// NewHost returns a Host block with no keywords for patterns, e.g.
+// NewHost("*.example.com", "!bastion.example.com").
+func NewHost(patterns ...string) (*Host, error) {
+	h := &Host{Nodes: make([]Node, 0)}
+	if err := h.SetPatterns(patterns...); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// NewMatchCriterion returns a criterion for a Match line. keyword may start
+// with "!" to negate the criterion. args are the patterns for criteria such as
+// "host" and "user", the networks for "localnetwork", or the command for
+// "exec"; "all", "canonical" and "final" take no arguments.
+//
+// The command for "exec" should not be quoted; it is quoted when the criterion
+// is printed if it contains spaces.
+func NewMatchCriterion(keyword string, args ...string) (*MatchCriterion, error) {
+	criterion := strings.ToLower(strings.TrimPrefix(keyword, "!"))
+	if criterion == "exec" {
+		if len(args) != 1 || args[0] == "" {
+			return nil, fmt.Errorf("ssh_config: Match %s requires a command", strings.TrimPrefix(keyword, "!"))
+		}
+		return &MatchCriterion{
+			Keyword: strings.TrimPrefix(keyword, "!"),
+			Negated: strings.HasPrefix(keyword, "!"),
+			Command: args[0],
+		}, nil
+	}
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\r\n#\"") {
+			return nil, fmt.Errorf("ssh_config: invalid argument %q for Match %s", arg, criterion)
+		}
+	}
+	return parseCriterion(keyword, args)
+}
+
+// NewMatch returns a Match block with no keywords for criteria, all of which
+// must match for the block to apply.
+func NewMatch(criteria ...*MatchCriterion) (*Host, error) {
+	if len(criteria) == 0 {
+		return nil, errors.New("ssh_config: Match directive requires at least one criterion")
+	}
+	if err := checkMatchAll(criteria); err != nil {
+		return nil, err
+	}
+	return &Host{
+		Patterns: matchPatternsFor(criteria),
+		Nodes:    make([]Node, 0),
+		isMatch:  true,
+		Criteria: criteria,
+	}, nil
+}
+
+// NewIncludeDirective returns an Include directive for the given file globs.
+// Unlike NewInclude, it does not read the included files, so Get and GetAll
+// find no values in them; encode the Config and decode it again to load them.
+func NewIncludeDirective(directives []string, opts ...NodeOption) (*Include, error) {
+	if len(directives) == 0 {
+		return nil, errors.New("ssh_config: Include requires at least one file")
+	}
+	for _, d := range directives {
+		if d == "" || strings.ContainsAny(d, " \t\r\n#") {
+			return nil, fmt.Errorf("ssh_config: invalid Include file %q", d)
+		}
+	}
+	o := applyOptions(opts)
+	return &Include{
+		Comment:      o.comment,
+		directives:   directives,
+		files:        make(map[string]*Config),
+		leadingSpace: o.indent,
+		hasEquals:    o.equals,
+	}, nil
+}
@@ -0,0 +1,120 @@
+package ssh_config
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustKV(t *testing.T, key, value string, opts ...NodeOption) *KV {
+	t.Helper()
+	kv, err := NewKV(key, value, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kv
+}
+
+func TestBuildConfig(t *testing.T) {
+	cfg := NewConfig()
+	inc, err := NewIncludeDirective([]string{"~/.ssh/config.d/*"}, WithComment(" generated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Hosts[0].Nodes = append(cfg.Hosts[0].Nodes,
+		NewEmpty(" Managed by onboard. Do not edit."),
+		inc,
+		NewEmpty(""),
+	)
+
+	bastion, err := NewHost("bastion", "bastion.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bastion.Nodes = append(bastion.Nodes,
+		mustKV(t, "HostName", "203.0.113.10", WithIndent(4)),
+		mustKV(t, "User", "deploy", WithIndent(4), WithComment(" shared account")),
+		mustKV(t, "IdentityFile", "~/Library/Mobile Documents/id_ed25519", WithIndent(4)),
+		NewEmpty(""),
+	)
+
+	onVPN, err := NewMatchCriterion("!exec", "test -f /tmp/on-vpn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	internal, err := NewMatchCriterion("host", "*.internal,*.corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	match, err := NewMatch(internal, onVPN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match.Nodes = append(match.Nodes, mustKV(t, "ProxyJump", "bastion", WithIndent(2), WithEquals()))
+	cfg.Hosts = append(cfg.Hosts, bastion, match)
+
+	want := `# Managed by onboard. Do not edit.
+Include ~/.ssh/config.d/* # generated
+
+Host bastion bastion.example.com
+    HostName 203.0.113.10
+    User deploy # shared account
+    IdentityFile "~/Library/Mobile Documents/id_ed25519"
+
+Match host *.internal,*.corp !exec "test -f /tmp/on-vpn"
+  ProxyJump = bastion
+`
+	got := cfg.String()
+	if got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// The generated config round-trips.
+	decoded, err := Decode(strings.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.String() != want {
+		t.Errorf("round-trip mismatch:\n%s", decoded.String())
+	}
+	if val, _ := decoded.Get("bastion", "IdentityFile"); val != "~/Library/Mobile Documents/id_ed25519" {
+		t.Errorf("Get(IdentityFile): got %q", val)
+	}
+	if val, _ := cfg.Get("bastion.example.com", "User"); val != "deploy" {
+		t.Errorf("Get(User) on built config: got %q", val)
+	}
+}
+
+func TestNewNodeErrors(t *testing.T) {
+	if _, err := NewKV("", "x"); err == nil {
+		t.Error("NewKV: expected error for empty key")
+	}
+	if _, err := NewKV("User", "x", WithComment("a\nb")); err == nil {
+		t.Error("NewKV: expected error for multi-line comment")
+	}
+	if _, err := NewHost(); err == nil {
+		t.Error("NewHost: expected error with no patterns")
+	}
+	if _, err := NewMatchCriterion("canonical", "yes"); err == nil || err.Error() != "ssh_config: Match canonical does not take an argument" {
+		t.Errorf("NewMatchCriterion(canonical, yes): got err %v", err)
+	}
+	if _, err := NewMatchCriterion("user"); err == nil || err.Error() != "ssh_config: Match user requires at least one pattern" {
+		t.Errorf("NewMatchCriterion(user): got err %v", err)
+	}
+	if _, err := NewMatchCriterion("bogus", "x"); err == nil || err.Error() != `ssh_config: unsupported Match criterion "bogus"` {
+		t.Errorf("NewMatchCriterion(bogus): got err %v", err)
+	}
+	all, err := NewMatchCriterion("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := NewMatchCriterion("user", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMatch(all, user); err == nil || err.Error() != "ssh_config: Match all cannot be combined with other criteria" {
+		t.Errorf("NewMatch(all, user): got err %v", err)
+	}
+	if _, err := NewIncludeDirective(nil); err == nil {
+		t.Error("NewIncludeDirective: expected error with no files")
+	}
+}
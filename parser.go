@@ -1,9 +1,11 @@
 package ssh_config
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 type sshParser struct {
@@ -16,28 +18,85 @@ type sshParser struct {
 	// filepaths in the Include directive
 	system bool
 	depth  uint8
+	// opts.Recover turns errors into Invalid nodes, which are collected in
+	// errs. lines holds the source, so the Invalid nodes can print the lines
+	// as they were.
+	opts  DecodeOptions
+	lines []string
+	errs  ParseErrors
+	// line and key are the line number and lowercased keyword of the line
+	// being parsed.
+	line int
+	key  string
 }
 
 type sshParserStateFn func() sshParserStateFn
 
 // Formats and panics an error message based on a token
 func (p *sshParser) raiseErrorf(tok *token, msg string) {
-	// TODO this format is ugly
-	panic(tok.Position.String() + ": " + msg)
+	panic(&ParseError{Pos: tok.Position, Msg: msg})
 }
 
+// raiseError panics with a ParseError for tok that wraps err.
 func (p *sshParser) raiseError(tok *token, err error) {
-	if err == ErrDepthExceeded {
-		panic(err)
-	}
-	// TODO this format is ugly
-	panic(tok.Position.String() + ": " + err.Error())
+	p.raiseWrapped(tok, err.Error(), err)
+}
+
+// raiseWrapped is like raiseError, but uses msg as the message.
+func (p *sshParser) raiseWrapped(tok *token, msg string, err error) {
+	panic(&ParseError{Pos: tok.Position, Msg: msg, Err: err})
 }
 
 func (p *sshParser) run() {
 	for state := p.parseStart; state != nil; {
-		state = state()
+		state = p.step(state)
+	}
+}
+
+// step runs state. If opts.Recover is set and state raises an error, step
+// records it, replaces the line with an Invalid node and continues with the
+// next line.
+func (p *sshParser) step(state sshParserStateFn) (next sshParserStateFn) {
+	if !p.opts.Recover {
+		return state()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			pe, ok := r.(*ParseError)
+			if !ok {
+				panic(r)
+			}
+			p.recoverLine(pe)
+			next = p.parseStart
+		}
+	}()
+	return state()
+}
+
+// recoverLine records pe and adds an Invalid node for the current line. An
+// invalid Host or Match line starts a block that never matches, so the
+// keywords that follow it do not apply to the block before it.
+func (p *sshParser) recoverLine(pe *ParseError) {
+	p.errs = append(p.errs, pe)
+	// Drop the rest of the line, if the error was raised partway through.
+	for tok := p.peek(); tok != nil && tok.typ != tokenEOF && tok.Line == p.line; tok = p.peek() {
+		p.getToken()
+	}
+	inv := &Invalid{Err: pe, position: Position{Line: p.line, Col: 1}}
+	if p.line > 0 && p.line <= len(p.lines) {
+		inv.line = strings.TrimSuffix(p.lines[p.line-1], "\r")
 	}
+	if p.key == "host" || p.key == "match" {
+		p.config.Hosts = append(p.config.Hosts, &Host{
+			Nodes:    make([]Node, 0),
+			isMatch:  true,
+			position: inv.position,
+			invalid:  inv,
+		})
+		return
+	}
+	lastHost := p.config.Hosts[len(p.config.Hosts)-1]
+	lastHost.Nodes = append(lastHost.Nodes, inv)
 }
 
 func (p *sshParser) peek() *token {
@@ -74,6 +133,7 @@ func (p *sshParser) parseStart() sshParserStateFn {
 		return nil
 	}
 
+	p.line, p.key = tok.Line, ""
 	switch tok.typ {
 	case tokenComment, tokenEmptyLine:
 		return p.parseComment
@@ -89,6 +149,7 @@ func (p *sshParser) parseStart() sshParserStateFn {
 
 func (p *sshParser) parseKV() sshParserStateFn {
 	key := p.getToken()
+	p.line, p.key = key.Line, strings.ToLower(key.val)
 	hasEquals := false
 	val := p.getToken()
 	if val.typ == tokenEquals {
@@ -105,7 +166,7 @@ func (p *sshParser) parseKV() sshParserStateFn {
 		comment = tok.val
 	}
 	if strings.ToLower(key.val) == "match" {
-		return p.parseMatch(val, hasEquals, comment)
+		return p.parseMatch(key, val, hasEquals, comment)
 	}
 	if strings.ToLower(key.val) == "host" {
 		strPatterns := strings.Split(val.val, " ")
@@ -116,7 +177,7 @@ func (p *sshParser) parseKV() sshParserStateFn {
 			}
 			pat, err := NewPattern(strPatterns[i])
 			if err != nil {
-				p.raiseErrorf(val, fmt.Sprintf("Invalid host pattern: %v", err))
+				p.raiseWrapped(val, fmt.Sprintf("Invalid host pattern: %v", err), err)
 				return nil
 			}
 			patterns = append(patterns, pat)
@@ -131,18 +192,31 @@ func (p *sshParser) parseKV() sshParserStateFn {
 			EOLComment:         comment,
 			spaceBeforeComment: spaceBeforeComment,
 			hasEquals:          hasEquals,
+			position:           key.Position,
 		})
 		return p.parseStart
 	}
 	lastHost := p.config.Hosts[len(p.config.Hosts)-1]
 	if strings.ToLower(key.val) == "include" {
-		inc, err := NewInclude(strings.Split(val.val, " "), hasEquals, key.Position, comment, p.system, p.depth+1)
+		inc, err := newInclude(strings.Fields(val.val), hasEquals, key.Position, comment, p.system, p.depth+1, p.opts)
+		if errs, ok := err.(ParseErrors); ok && inc != nil {
+			for _, pe := range errs {
+				p.errs = append(p.errs, pe.included())
+			}
+			err = nil
+		}
+		var nested *ParseError
+		if errors.As(err, &nested) {
+			// The error is in an included file. Record that it was
+			// included from this one; parseWithDepth fills in the name.
+			panic(nested.included())
+		}
 		if err == ErrDepthExceeded {
 			p.raiseError(val, err)
 			return nil
 		}
 		if err != nil {
-			p.raiseErrorf(val, fmt.Sprintf("Error parsing Include directive: %v", err))
+			p.raiseWrapped(val, fmt.Sprintf("Error parsing Include directive: %v", err), err)
 			return nil
 		}
 		lastHost.Nodes = append(lastHost.Nodes, inc)
@@ -163,76 +237,90 @@ func (p *sshParser) parseKV() sshParserStateFn {
 		hasEquals:       hasEquals,
 		leadingSpace:    key.Position.Col - 1,
 		position:        key.Position,
+		valuePosition:   val.Position,
 	}
 	lastHost.Nodes = append(lastHost.Nodes, kv)
 	return p.parseStart
 }
 
-func (p *sshParser) parseMatch(val *token, hasEquals bool, comment string) sshParserStateFn {
+func (p *sshParser) parseMatch(key, val *token, hasEquals bool, comment string) sshParserStateFn {
 	// val.val contains everything after "Match ", e.g. "Host *.example.com"
 	// or "all".
 	trimmed := strings.TrimRightFunc(val.val, unicode.IsSpace)
 	spaceBeforeComment := val.val[len(trimmed):]
-	fields := strings.Fields(trimmed)
+	fields, err := splitMatchArgs(trimmed)
+	if err != nil {
+		p.raiseError(val, err)
+		return nil
+	}
 	if len(fields) == 0 {
 		p.raiseErrorf(val, "ssh_config: Match directive requires at least one criterion")
 		return nil
 	}
-	criterion := strings.ToLower(fields[0])
-
-	switch criterion {
-	case "all":
-		// "Match all" is equivalent to "Host *" — matches everything.
-		p.config.Hosts = append(p.config.Hosts, &Host{
-			Patterns:           []*Pattern{matchAll},
-			Nodes:              make([]Node, 0),
-			EOLComment:         comment,
-			spaceBeforeComment: spaceBeforeComment,
-			hasEquals:          hasEquals,
-			isMatch:            true,
-			matchKeyword:       fields[0], // preserve original case
-		})
-		return p.parseStart
 
-	case "host":
-		patterns := make([]*Pattern, 0)
-		for _, s := range fields[1:] {
-			if s == "" {
-				continue
+	cols := fieldColumns(trimmed, fields, val.Col)
+	criteria := make([]*MatchCriterion, 0, 1)
+	for i := 0; i < len(fields); {
+		word, wordCol := fields[i], cols[i]
+		criterion := strings.ToLower(strings.TrimPrefix(word, "!"))
+		i++
+		start := i
+		switch {
+		case singleArgCriteria[criterion], criterion == "exec":
+			// "exec" is a session type as well as a criterion, so these
+			// take exactly one argument, as in ssh.
+			if i < len(fields) {
+				i++
 			}
-			pat, err := NewPattern(s)
-			if err != nil {
-				p.raiseErrorf(val, fmt.Sprintf("Invalid host pattern: %v", err))
-				return nil
+		case criteriaWithPatterns[criterion], criterion == "localnetwork":
+			// A criterion takes every following word up to the next
+			// criterion, so "Match Host a b" continues to work.
+			for i < len(fields) && !isCriterion(fields[i]) {
+				i++
 			}
-			patterns = append(patterns, pat)
 		}
-		if len(patterns) == 0 {
-			p.raiseErrorf(val, "ssh_config: Match Host requires at least one pattern")
+		c, err := parseCriterion(word, fields[start:i])
+		if err != nil {
+			// Point at the criterion, rather than the start of the line.
+			tok := *val
+			tok.Col = wordCol
+			p.raiseError(&tok, err)
 			return nil
 		}
-		p.config.Hosts = append(p.config.Hosts, &Host{
-			Patterns:           patterns,
-			Nodes:              make([]Node, 0),
-			EOLComment:         comment,
-			spaceBeforeComment: spaceBeforeComment,
-			hasEquals:          hasEquals,
-			isMatch:            true,
-			matchKeyword:       fields[0], // preserve original case
-		})
-		return p.parseStart
-
-	case "exec":
-		// Match Exec runs arbitrary commands. Supporting it would allow
-		// untrusted SSH config files to execute code on the parsing
-		// machine. Reject it explicitly.
-		p.raiseErrorf(val, "ssh_config: Match Exec is not supported")
+		criteria = append(criteria, c)
+	}
+	if err := checkMatchAll(criteria); err != nil {
+		p.raiseError(val, err)
 		return nil
+	}
 
-	default:
-		p.raiseErrorf(val, fmt.Sprintf("ssh_config: unsupported Match criterion %q", criterion))
-		return nil
+	host := &Host{
+		Nodes:              make([]Node, 0),
+		EOLComment:         comment,
+		spaceBeforeComment: spaceBeforeComment,
+		hasEquals:          hasEquals,
+		isMatch:            true,
+		Criteria:           criteria,
+		position:           key.Position,
 	}
+	host.Patterns = matchPatternsFor(criteria)
+	p.config.Hosts = append(p.config.Hosts, host)
+	return p.parseStart
+}
+
+// fieldColumns returns the column of each of fields, which were split from s,
+// given that s starts at column col.
+func fieldColumns(s string, fields []string, col int) []int {
+	cols := make([]int, len(fields))
+	offset := 0
+	for i, field := range fields {
+		if idx := strings.Index(s[offset:], field); idx >= 0 {
+			offset += idx
+		}
+		cols[i] = col + utf8.RuneCountInString(s[:offset])
+		offset += len(field)
+	}
+	return cols
 }
 
 func (p *sshParser) parseComment() sshParserStateFn {
@@ -247,7 +335,7 @@ func (p *sshParser) parseComment() sshParserStateFn {
 	return p.parseStart
 }
 
-func parseSSH(flow chan token, system bool, depth uint8) *Config {
+func parseSSH(flow chan token, system bool, depth uint8, opts DecodeOptions, src []byte) (*Config, ParseErrors) {
 	// Ensure we consume tokens to completion even if parser exits early
 	defer func() {
 		for range flow {
@@ -264,7 +352,11 @@ func parseSSH(flow chan token, system bool, depth uint8) *Config {
 		seenTableKeys: make([]string, 0),
 		system:        system,
 		depth:         depth,
+		opts:          opts,
+	}
+	if opts.Recover {
+		parser.lines = strings.Split(string(src), "\n")
 	}
 	parser.run()
-	return result
+	return result, parser.errs
 }
@@ -2,6 +2,10 @@ package ssh_config
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -22,3 +26,213 @@ func TestIOError(t *testing.T) {
 		t.Errorf("expected read error msg, got %v", err)
 	}
 }
+
+var parseErrorTests = []struct {
+	config string
+	pos    Position
+	msg    string
+	target error
+}{
+	{"Host example\n  Match bogus x\n", Position{2, 9}, `ssh_config: unsupported Match criterion "bogus"`, ErrUnsupportedMatch},
+	{"Include [\n", Position{1, 9}, `Error parsing Include directive: ssh_config: invalid Include glob "[": syntax error in pattern`, ErrIncludeGlob},
+	{"Match exec \"true\n", Position{1, 7}, "ssh_config: unterminated quote in Match directive", nil},
+}
+
+func TestParseError(t *testing.T) {
+	for _, tt := range parseErrorTests {
+		_, err := Decode(strings.NewReader(tt.config))
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("Decode(%q): expected a *ParseError, got %v", tt.config, err)
+			continue
+		}
+		if pe.Pos != tt.pos {
+			t.Errorf("Decode(%q): got position %s, want %s", tt.config, pe.Pos, tt.pos)
+		}
+		if pe.Msg != tt.msg {
+			t.Errorf("Decode(%q): got message %q, want %q", tt.config, pe.Msg, tt.msg)
+		}
+		if pe.File != "" || len(pe.IncludeChain) != 0 {
+			t.Errorf("Decode(%q): got File %q and IncludeChain %q, want neither", tt.config, pe.File, pe.IncludeChain)
+		}
+		if tt.target != nil && !errors.Is(err, tt.target) {
+			t.Errorf("Decode(%q): expected errors.Is(err, %v)", tt.config, tt.target)
+		}
+		if want := tt.pos.String() + ": " + tt.msg; err.Error() != want {
+			t.Errorf("Decode(%q): got %q, want %q", tt.config, err.Error(), want)
+		}
+	}
+}
+
+func TestParseErrorInIncludedFile(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad")
+	if err := os.WriteFile(bad, []byte("Host example\n    Port 22\nMatch nope\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	middle := filepath.Join(dir, "middle")
+	if err := os.WriteFile(middle, []byte("Include "+bad+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	top := filepath.Join(dir, "top")
+	if err := os.WriteFile(top, []byte("Host *\n    Include "+middle+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := parseFile(top)
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a *ParseError, got %v", err)
+	}
+	if !errors.Is(err, ErrUnsupportedMatch) {
+		t.Errorf("expected errors.Is(err, ErrUnsupportedMatch), got %v", err)
+	}
+	if pe.File != bad {
+		t.Errorf("File: got %q, want %q", pe.File, bad)
+	}
+	if pe.Pos.Line != 3 {
+		t.Errorf("Line: got %d, want 3", pe.Pos.Line)
+	}
+	if want := []string{top, middle}; !reflect.DeepEqual(pe.IncludeChain, want) {
+		t.Errorf("IncludeChain: got %q, want %q", pe.IncludeChain, want)
+	}
+	want := bad + ` (3, 7): ssh_config: unsupported Match criterion "nope" (included from ` + top + " -> " + middle + ")"
+	if err.Error() != want {
+		t.Errorf("Error():\ngot  %s\nwant %s", err.Error(), want)
+	}
+
+	_, err = Decode(strings.NewReader("Include " + middle + "\n"))
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a *ParseError, got %v", err)
+	}
+	if want := []string{"", middle}; !reflect.DeepEqual(pe.IncludeChain, want) {
+		t.Errorf("IncludeChain from Decode: got %q, want %q", pe.IncludeChain, want)
+	}
+}
+
+func TestInvalidPattern(t *testing.T) {
+	_, err := NewPattern("")
+	if !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("NewPattern(\"\"): expected ErrInvalidPattern, got %v", err)
+	}
+	_, err = NewHost("")
+	if !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("NewHost(\"\"): expected ErrInvalidPattern, got %v", err)
+	}
+}
+
+var recoverConfig = `Host a
+    User alice
+Match bogus
+    User bob
+Host b
+    Port 2222
+  Match host # no patterns
+    Port 22
+Include [
+Host c
+    Port 2022
+`
+
+func TestDecodeWithOptionsRecover(t *testing.T) {
+	cfg, err := DecodeWithOptions(strings.NewReader(recoverConfig), DecodeOptions{Recover: true})
+	errs, ok := err.(ParseErrors)
+	if !ok {
+		t.Fatalf("expected ParseErrors, got %v", err)
+	}
+	if cfg == nil {
+		t.Fatal("expected a partial Config")
+	}
+	wantLines := []int{3, 7, 9}
+	if len(errs) != len(wantLines) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(wantLines), err)
+	}
+	for i, line := range wantLines {
+		if errs[i].Pos.Line != line {
+			t.Errorf("error %d: got line %d, want %d", i, errs[i].Pos.Line, line)
+		}
+	}
+	if !errors.Is(errs[0], ErrUnsupportedMatch) || !errors.Is(errs[2], ErrIncludeGlob) {
+		t.Errorf("unexpected errors: %v", err)
+	}
+	if got := cfg.String(); got != recoverConfig {
+		t.Errorf("round trip:\ngot\n%s\nwant\n%s", got, recoverConfig)
+	}
+
+	for _, tt := range []struct{ alias, key, want string }{
+		{"a", "User", "alice"},
+		{"bogus", "User", ""},
+		{"b", "Port", "2222"},
+		{"c", "Port", "2022"},
+	} {
+		if got, err := cfg.Get(tt.alias, tt.key); err != nil || got != tt.want {
+			t.Errorf("Get(%q, %q): got %q, %v, want %q", tt.alias, tt.key, got, err, tt.want)
+		}
+	}
+	r, err := cfg.Resolve("bogus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Has("User") {
+		t.Errorf("keywords under an invalid Match line should not apply, got User %q", r.Get("User"))
+	}
+
+	var inv *Invalid
+	for _, node := range cfg.Hosts[len(cfg.Hosts)-2].Nodes {
+		if n, ok := node.(*Invalid); ok {
+			inv = n
+		}
+	}
+	if inv == nil {
+		t.Fatal("expected an Invalid node for the Include line")
+	}
+	if inv.Err != errs[2] || inv.Pos().Line != 9 || inv.String() != "Include [" {
+		t.Errorf("Invalid: got %+v", inv)
+	}
+
+	// Without Recover, decoding stops at the first error.
+	_, err = Decode(strings.NewReader(recoverConfig))
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Pos.Line != 3 {
+		t.Errorf("Decode: expected a ParseError for line 3, got %v", err)
+	}
+}
+
+func TestDecodeWithOptionsRecoverInclude(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad")
+	if err := os.WriteFile(bad, []byte("Match nope\nHost ok\n    Port 22\nMatch all host x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := "Include " + bad + "\nMatch what\n"
+	cfg, err := DecodeWithOptions(strings.NewReader(config), DecodeOptions{Recover: true})
+	errs, ok := err.(ParseErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("expected 3 ParseErrors, got %v", err)
+	}
+	for i, want := range []struct {
+		file  string
+		line  int
+		chain []string
+	}{
+		{bad, 1, []string{""}},
+		{bad, 4, []string{""}},
+		{"", 2, nil},
+	} {
+		if errs[i].File != want.file || errs[i].Pos.Line != want.line || !reflect.DeepEqual(errs[i].IncludeChain, want.chain) {
+			t.Errorf("error %d: got %s %d %q, want %s %d %q", i, errs[i].File, errs[i].Pos.Line, errs[i].IncludeChain, want.file, want.line, want.chain)
+		}
+	}
+	if got, err := cfg.Get("ok", "Port"); err != nil || got != "22" {
+		t.Errorf("Get(ok, Port): got %q, %v", got, err)
+	}
+}
+
+func TestDecodeWithOptionsValid(t *testing.T) {
+	cfg, err := DecodeWithOptions(strings.NewReader("Host a\n    User alice\n"), DecodeOptions{Recover: true})
+	if err != nil {
+		t.Fatalf("expected a nil error, got %#v", err)
+	}
+	if got, _ := cfg.Get("a", "User"); got != "alice" {
+		t.Errorf("got %q, want alice", got)
+	}
+}
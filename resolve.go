@@ -0,0 +1,549 @@
+package ssh_config
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ResolvedHost contains every option that applies to a single host, in the
+// same way that "ssh -G host" prints the effective configuration for a host.
+//
+// For most keywords the first obtained value wins; later values for the same
+// keyword are ignored. Keywords that may be specified multiple times (see
+// SupportsMultiple) collect every value in the order they were found.
+type ResolvedHost struct {
+	// Alias is the host name that was passed to Resolve.
+	Alias string
+	// LocalUser is the local user name from the MatchContext that the host
+	// was resolved with. MarshalText prints it as the user if no User was
+	// set, as ssh does.
+	LocalUser string
+	// CanonicalHost is the host name found by hostname canonicalization, or
+	// the empty string if the host name was not canonicalized. See
+	// ResolveFinal.
+	CanonicalHost string
+	// Trace lists each step taken to resolve the host: every block that was
+	// evaluated and why it did or did not match, every included file, and
+	// every value that was used or ignored. Trace is empty for a ResolvedHost
+	// read with DecodeResolved.
+	Trace []TraceEvent
+
+	// dialect is the OpenSSH release whose defaults were applied.
+	dialect Dialect
+	// keys holds lowercased keywords in the order they were first set.
+	// Obsolete aliases are stored under the current name; see canonicalKey.
+	keys   []string
+	values map[string][]*resolvedValue
+}
+
+// resolvedValue is a single value for a keyword. src is nil if the value is a
+// default, rather than one read from a config file.
+type resolvedValue struct {
+	value string
+	src   *Source
+	// pass is FirstPass or FinalPass, or 0 if the value was not read from a
+	// config file.
+	pass int
+}
+
+func newResolvedHost(alias string) *ResolvedHost {
+	return &ResolvedHost{
+		Alias:  alias,
+		keys:   make([]string, 0),
+		values: make(map[string][]*resolvedValue),
+	}
+}
+
+// set records val for key, applying the "first obtained value wins" rule.
+// If the value was not used, set returns the reason; otherwise it returns the
+// empty string.
+//
+// As in ssh, a value for a keyword that may be specified multiple times is
+// ignored in the final pass if the first pass already added it.
+func (r *ResolvedHost) set(key, val string, src *Source, pass int) string {
+	lkey := canonicalKey(key)
+	existing, ok := r.values[lkey]
+	if ok && !SupportsMultiple(lkey) {
+		reason := fmt.Sprintf("already set to %q", existing[0].value)
+		if prev := existing[0].src; prev != nil {
+			reason += " at " + location(prev.File, prev.Position)
+		}
+		return reason
+	}
+	if pass == FinalPass {
+		for _, v := range existing {
+			if v.pass == FirstPass && v.value == val {
+				return "already added in the first pass"
+			}
+		}
+	}
+	if !ok {
+		r.keys = append(r.keys, lkey)
+	}
+	r.values[lkey] = append(existing, &resolvedValue{value: val, src: src, pass: pass})
+	return ""
+}
+
+// Get returns the value for key, or the empty string if key was not set. If
+// the keyword may be specified multiple times, Get returns the first value.
+//
+// The match for key is case insensitive. An obsolete name such as
+// PubkeyAcceptedKeyTypes refers to the same value as the current name, as in
+// ssh.
+func (r *ResolvedHost) Get(key string) string {
+	vals := r.values[canonicalKey(key)]
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[0].value
+}
+
+// GetAll returns every value for key in the order they were found, or nil if
+// key was not set. Path lists such as UserKnownHostsFile are split into one
+// element per path.
+//
+// The match for key is case insensitive.
+func (r *ResolvedHost) GetAll(key string) []string {
+	vals := r.values[canonicalKey(key)]
+	if len(vals) == 0 {
+		return nil
+	}
+	all := make([]string, 0, len(vals))
+	for _, v := range vals {
+		all = appendValue(all, key, v.value, v.kv())
+	}
+	return all
+}
+
+// kv returns the line that set v, or nil if v is a default.
+func (v *resolvedValue) kv() *KV {
+	if v.src == nil {
+		return nil
+	}
+	return v.src.KV
+}
+
+// Has reports whether key has a value.
+func (r *ResolvedHost) Has(key string) bool {
+	return len(r.values[canonicalKey(key)]) > 0
+}
+
+// Pass returns the pass in which the value for key was set: FirstPass or
+// FinalPass. Pass returns 0 if key was not set, or if the value did not come
+// from a config file, e.g. a default. If the keyword may be specified multiple
+// times, Pass returns the pass for the first value; use Passes to get the pass
+// for every value.
+func (r *ResolvedHost) Pass(key string) int {
+	vals := r.values[canonicalKey(key)]
+	if len(vals) == 0 {
+		return 0
+	}
+	return vals[0].pass
+}
+
+// Passes returns the pass in which each value returned by GetAll was set.
+func (r *ResolvedHost) Passes(key string) []int {
+	vals := r.values[canonicalKey(key)]
+	if len(vals) == 0 {
+		return nil
+	}
+	passes := make([]int, len(vals))
+	for i := range vals {
+		passes[i] = vals[i].pass
+	}
+	return passes
+}
+
+// Keys returns the lowercased keywords that have a value, in the order they
+// were first set.
+func (r *ResolvedHost) Keys() []string {
+	keys := make([]string, len(r.keys))
+	copy(keys, r.keys)
+	return keys
+}
+
+// HostName returns the HostName for the resolved host. If the host name was
+// canonicalized, the canonical name is returned. If no HostName was set, the
+// alias is returned, since that is the name ssh will connect to.
+func (r *ResolvedHost) HostName() string {
+	if r.CanonicalHost != "" {
+		return r.CanonicalHost
+	}
+	if h := r.Get("HostName"); h != "" {
+		return h
+	}
+	return r.Alias
+}
+
+// User returns the User for the resolved host, or the empty string if no User
+// was set.
+func (r *ResolvedHost) User() string {
+	return r.Get("User")
+}
+
+// Port returns the Port for the resolved host. If no Port was set, Port
+// returns 0 and a nil error.
+func (r *ResolvedHost) Port() (int, error) {
+	val := r.Get("Port")
+	if val == "" {
+		return 0, nil
+	}
+	port, err := strconv.ParseUint(val, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("ssh_config: invalid Port %q: %v", val, err)
+	}
+	return int(port), nil
+}
+
+// IdentityFiles returns every IdentityFile for the resolved host.
+func (r *ResolvedHost) IdentityFiles() []string {
+	return r.GetAll("IdentityFile")
+}
+
+// resolver walks one or more Configs, collecting every value that applies to
+// the host in ctx.
+type resolver struct {
+	ctx    *MatchContext
+	result *ResolvedHost
+	// wantFinal is true if a "Match final" criterion was seen, which
+	// requests a final pass over the configuration.
+	wantFinal bool
+	// file and host are the file and block currently being walked, and
+	// chain the files whose Include directives led to file.
+	file  string
+	host  *Host
+	chain []string
+}
+
+func newResolver(ctx *MatchContext) *resolver {
+	result := newResolvedHost(ctx.OriginalHost)
+	result.LocalUser = ctx.LocalUser
+	return &resolver{ctx: ctx, result: result}
+}
+
+// matchContext returns the values that the next Host or Match block should be
+// evaluated against; see matchContextFor.
+func (r *resolver) matchContext() *MatchContext {
+	return matchContextFor(r.ctx, r.result)
+}
+
+// matchContextFor returns a copy of base for evaluating the next Host or Match
+// block, given the values that earlier blocks set in seen. As in ssh, "Match
+// host" is evaluated against the HostName if one has already been set, and
+// "Match user", "Match tagged", "Match sessiontype" and "Match command"
+// against the User, Tag, SessionType and RemoteCommand, unless the caller
+// supplied a value in base.
+func matchContextFor(base *MatchContext, seen *ResolvedHost) *MatchContext {
+	ctx := *base
+	if ctx.Pass == FinalPass {
+		// HostName was already substituted into Host before the final pass.
+		ctx.matchHost = ctx.host()
+	} else if hostname := seen.Get("HostName"); hostname != "" {
+		tc := &TokenContext{Host: base.host()}
+		if expanded, err := ExpandTokens("HostName", hostname, tc); err == nil {
+			ctx.matchHost = expanded
+		}
+	}
+	if ctx.RemoteUser == "" {
+		ctx.RemoteUser = seen.User()
+	}
+	if ctx.Tag == "" {
+		ctx.Tag = seen.Get("Tag")
+	}
+	if ctx.SessionType == "" {
+		ctx.SessionType = seen.Get("SessionType")
+	}
+	if ctx.Command == "" {
+		ctx.Command = seen.Get("RemoteCommand")
+	}
+	ctx.port = seen.Get("Port")
+	ctx.jumpHost = seen.Get("ProxyJump")
+	return &ctx
+}
+
+func (r *resolver) walk(c *Config) error {
+	if c == nil {
+		return nil
+	}
+	prevFile, prevHost := r.file, r.host
+	defer func() { r.file, r.host = prevFile, prevHost }()
+	r.file = c.filename
+	for _, host := range c.Hosts {
+		for _, crit := range host.Criteria {
+			if strings.EqualFold(crit.Keyword, "final") && !crit.Negated {
+				r.wantFinal = true
+			}
+		}
+		ok, reason, err := host.explainMatch(r.matchContext())
+		if err != nil {
+			return err
+		}
+		if !host.implicit || len(host.Nodes) > 0 {
+			r.trace(TraceEvent{Kind: TraceBlock, Position: host.position, Host: host, Matched: ok, Reason: reason})
+		}
+		if !ok {
+			continue
+		}
+		r.host = host
+		if err := r.walkNodes(host.Nodes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trace records ev, filling in the pass and, if it is not set, the file.
+func (r *resolver) trace(ev TraceEvent) {
+	ev.Pass = r.pass()
+	if ev.File == "" {
+		ev.File = r.file
+	}
+	r.result.Trace = append(r.result.Trace, ev)
+}
+
+func (r *resolver) pass() int {
+	if r.ctx.Pass == FinalPass {
+		return FinalPass
+	}
+	return FirstPass
+}
+
+func (r *resolver) walkNodes(nodes []Node) error {
+	for _, node := range nodes {
+		switch t := node.(type) {
+		case *Empty, *Invalid:
+			continue
+		case *KV:
+			ev := TraceEvent{Kind: TraceSet, Position: t.Pos(), Host: r.host, Key: t.Key, Value: t.Value}
+			if reason := r.result.set(t.Key, t.Value, newSource(t, r.file, r.host, r.chain), r.pass()); reason != "" {
+				ev.Kind, ev.Reason = TraceIgnore, reason
+			}
+			r.trace(ev)
+		case *Include:
+			if err := r.walkInclude(t); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown Node type %v", t)
+		}
+	}
+	return nil
+}
+
+func (r *resolver) walkInclude(inc *Include) error {
+	inc.mu.Lock()
+	defer inc.mu.Unlock()
+	if len(inc.matches) == 0 {
+		r.trace(TraceEvent{Kind: TraceInclude, Position: inc.Pos(), Host: r.host, Reason: fmt.Sprintf("no files match %s", strings.Join(inc.directives, " "))})
+	}
+	r.chain = append(r.chain, r.file)
+	defer func() { r.chain = r.chain[:len(r.chain)-1] }()
+	for i := range inc.matches {
+		cfg := inc.files[inc.matches[i]]
+		if cfg == nil {
+			panic("nil cfg")
+		}
+		r.trace(TraceEvent{Kind: TraceInclude, Position: inc.Pos(), Host: r.host, Value: inc.matches[i]})
+		if err := r.walk(cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveFinal walks configs once, and then a second time with final pass
+// semantics if CanonicalizeHostname is enabled or a "Match final" criterion
+// was seen. Before the final pass the host name is replaced with the HostName
+// found in the first pass, lowercased and canonicalized, as ssh does.
+func resolveFinal(ctx *MatchContext, configs []*Config) (*ResolvedHost, error) {
+	first := *ctx
+	first.Pass = FirstPass
+	r := newResolver(&first)
+	for _, c := range configs {
+		if err := r.walk(c); err != nil {
+			return nil, err
+		}
+	}
+	canonicalize := strings.ToLower(r.result.Get("CanonicalizeHostname"))
+	if !r.wantFinal && !canonicalizeEnabled(canonicalize) {
+		return r.result, nil
+	}
+	final := *ctx
+	final.Pass = FinalPass
+	final.Host = first.host()
+	if hostname := r.result.Get("HostName"); hostname != "" {
+		expanded, err := ExpandTokens("HostName", hostname, &TokenContext{Host: first.host()})
+		if err != nil {
+			return nil, err
+		}
+		final.Host = expanded
+	}
+	final.Host = strings.ToLower(final.Host)
+	if canonicalizeEnabled(canonicalize) {
+		res := ctx.Resolver
+		if res == nil {
+			res = net.DefaultResolver
+		}
+		canonical, err := r.result.Canonicalize(context.Background(), res, final.Host)
+		if err != nil {
+			return nil, err
+		}
+		if canonical != final.Host {
+			r.trace(TraceEvent{Kind: TraceCanonicalize, Key: "HostName", Value: canonical, Reason: fmt.Sprintf("%q => %q", final.Host, canonical)})
+			r.result.CanonicalHost = canonical
+			final.Host = canonical
+		}
+	}
+	r.ctx = &final
+	for _, c := range configs {
+		if err := r.walk(c); err != nil {
+			return nil, err
+		}
+	}
+	return r.result, nil
+}
+
+// applyDefaults sets the default value in r.result.dialect for every keyword
+// that has one and was not set in any config file. Keywords that may be
+// specified multiple times, such as IdentityFile, get every default value.
+func (r *resolver) applyDefaults() {
+	d := r.result.dialect
+	defaults := d.defaults()
+	for _, key := range sortedKeys(defaults) {
+		if !r.result.Has(key) {
+			r.result.set(key, defaults[key], nil, 0)
+		}
+	}
+	for key := range listDefaults {
+		if !SupportsMultiple(key) || r.result.Has(key) {
+			continue
+		}
+		for _, val := range d.DefaultAll(key) {
+			r.result.set(key, val, nil, 0)
+		}
+	}
+}
+
+// validate checks every value read from a config file, the same way GetStrict
+// does.
+func (r *ResolvedHost) validate() error {
+	for _, key := range r.keys {
+		for _, val := range r.values[key] {
+			if val.src == nil {
+				continue
+			}
+			if err := validateKV(val.src.File, val.src.KV); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Resolve walks the configuration once and returns every value that applies
+// to alias. For each keyword the first obtained value wins, and keywords that
+// may be specified multiple times collect every value.
+//
+// Unlike UserSettings.Resolve, default values are not included in the result.
+//
+// Match blocks are evaluated against NewMatchContext(alias); use
+// ResolveContext to control the values that are matched.
+func (c *Config) Resolve(alias string) (*ResolvedHost, error) {
+	return c.ResolveContext(NewMatchContext(alias))
+}
+
+// ResolveContext is like Resolve, but evaluates Host and Match blocks against
+// the values in ctx. The alias for the returned ResolvedHost is
+// ctx.OriginalHost.
+func (c *Config) ResolveContext(ctx *MatchContext) (*ResolvedHost, error) {
+	r := newResolver(ctx)
+	if err := r.walk(c); err != nil {
+		return nil, err
+	}
+	return r.result, nil
+}
+
+// ResolveFinal is like ResolveContext, but reads the configuration a second
+// time if CanonicalizeHostname is enabled or a "Match final" block requests
+// it, as ssh does. In the second pass ctx.Host is replaced with the HostName
+// found in the first pass, canonicalized using ctx.Resolver if
+// CanonicalizeHostname is enabled. "Match canonical" and "Match final" blocks
+// apply, and keywords that were set in the first pass keep their value. Use
+// ResolvedHost.Pass to find the pass that set a value, and
+// ResolvedHost.CanonicalHost for the canonical host name.
+func (c *Config) ResolveFinal(ctx *MatchContext) (*ResolvedHost, error) {
+	return resolveFinal(ctx, []*Config{c})
+}
+
+// Resolve finds every value that applies to alias in a single pass over the
+// user and system configuration files. Values from the user's configuration
+// take precedence over values from the system configuration, and keywords
+// that were not set in either file are filled in with their default value.
+//
+// The returned error will be non-nil if a configuration file could not be
+// parsed and u.IgnoreErrors is false, or if a value is invalid for its
+// keyword.
+func (u *UserSettings) Resolve(alias string) (*ResolvedHost, error) {
+	return u.ResolveContext(NewMatchContext(alias))
+}
+
+// ResolveContext is like Resolve, but evaluates Host and Match blocks against
+// the values in ctx. The alias for the returned ResolvedHost is
+// ctx.OriginalHost.
+func (u *UserSettings) ResolveContext(ctx *MatchContext) (*ResolvedHost, error) {
+	u.doLoadConfigs()
+	//lint:ignore S1002 I prefer it this way
+	if u.onceErr != nil && u.IgnoreErrors == false {
+		return nil, u.onceErr
+	}
+	r := newResolver(u.matchContext(ctx))
+	for _, c := range u.configs() {
+		if err := r.walk(c); err != nil {
+			return nil, err
+		}
+	}
+	return finishResolve(r.result, u.Dialect)
+}
+
+// ResolveFinal is like ResolveContext, but reads the configuration files a
+// second time if CanonicalizeHostname is enabled or a "Match final" block
+// requests it. See Config.ResolveFinal.
+func (u *UserSettings) ResolveFinal(ctx *MatchContext) (*ResolvedHost, error) {
+	u.doLoadConfigs()
+	//lint:ignore S1002 I prefer it this way
+	if u.onceErr != nil && u.IgnoreErrors == false {
+		return nil, u.onceErr
+	}
+	result, err := resolveFinal(u.matchContext(ctx), u.configs())
+	if err != nil {
+		return nil, err
+	}
+	return finishResolve(result, u.Dialect)
+}
+
+// configs returns the loaded configuration files in the order they are read.
+func (u *UserSettings) configs() []*Config {
+	return []*Config{u.customConfig, u.userConfig, u.systemConfig}
+}
+
+// finishResolve validates result and fills in the default values for dialect.
+func finishResolve(result *ResolvedHost, dialect Dialect) (*ResolvedHost, error) {
+	if err := result.validate(); err != nil {
+		return nil, err
+	}
+	result.dialect = dialect
+	r := &resolver{result: result}
+	r.applyDefaults()
+	return result, nil
+}
+
+// Resolve finds every value that applies to alias, using the default user
+// settings.
+//
+// Resolve is a wrapper around DefaultUserSettings.Resolve.
+func Resolve(alias string) (*ResolvedHost, error) {
+	return DefaultUserSettings.Resolve(alias)
+}
@@ -0,0 +1,252 @@
+package ssh_config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigResolve(t *testing.T) {
+	data := loadFile(t, "testdata/match-mixed")
+	cfg, err := Decode(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.Resolve("app.prod.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Alias != "app.prod.example.com" {
+		t.Errorf("Alias: got %q", r.Alias)
+	}
+	if got := r.Get("Port"); got != "2222" {
+		t.Errorf("Get(Port): got %q, want 2222", got)
+	}
+	if got := r.User(); got != "deploy" {
+		t.Errorf("User(): got %q, want deploy", got)
+	}
+	port, err := r.Port()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != 2222 {
+		t.Errorf("Port(): got %d, want 2222", port)
+	}
+	want := []string{"~/.ssh/prod_key1", "~/.ssh/prod_key2", "~/.ssh/default_key"}
+	if got := r.IdentityFiles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("IdentityFiles(): got %q, want %q", got, want)
+	}
+	if got := r.HostName(); got != "app.prod.example.com" {
+		t.Errorf("HostName(): got %q, want alias", got)
+	}
+	if got := r.Keys(); !reflect.DeepEqual(got, []string{"port", "user", "identityfile"}) {
+		t.Errorf("Keys(): got %q", got)
+	}
+	// Default values are not included when resolving a single Config.
+	if r.Has("PasswordAuthentication") {
+		t.Errorf("expected no default for PasswordAuthentication")
+	}
+}
+
+func TestConfigResolveMatchesGet(t *testing.T) {
+	data := loadFile(t, "testdata/config3")
+	cfg, err := Decode(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, alias := range []string{"bastion.stage.i.us.example.net", "10.2.3.4", "20.20.20.4", "20.20.20.20"} {
+		r, err := cfg.Resolve(alias)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"User", "Port", "ProxyCommand", "UserKnownHostsFile", "UseKeychain"} {
+			want, _ := cfg.Get(alias, key)
+			if got := r.Get(key); got != want {
+				t.Errorf("Resolve(%q).Get(%q): got %q, want %q", alias, key, got, want)
+			}
+		}
+		wantAll, _ := cfg.GetAll(alias, "IdentityFile")
+		if got := r.GetAll("IdentityFile"); !reflect.DeepEqual(got, wantAll) {
+			t.Errorf("Resolve(%q).GetAll(IdentityFile): got %q, want %q", alias, got, wantAll)
+		}
+	}
+}
+
+func TestUserSettingsResolve(t *testing.T) {
+	us := &UserSettings{
+		userConfigFinder:   testConfigFinder("testdata/config1"),
+		systemConfigFinder: nullConfigFinder,
+	}
+	r, err := us.Resolve("wap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.User(); got != "root" {
+		t.Errorf("User(): got %q, want root", got)
+	}
+	if got := r.Get("PasswordAuthentication"); got != "yes" {
+		t.Errorf("expected default PasswordAuthentication yes, got %q", got)
+	}
+	if got := r.Get("HostKeyAlgorithms"); got != "ssh-ed25519,ssh-rsa" {
+		t.Errorf("HostKeyAlgorithms: got %q", got)
+	}
+	if got := r.GetAll("SendEnv"); !reflect.DeepEqual(got, []string{"LANG LC_*"}) {
+		t.Errorf("SendEnv: got %q", got)
+	}
+}
+
+func TestUserSettingsResolveInvalid(t *testing.T) {
+	us := &UserSettings{
+		userConfigFinder:   testConfigFinder("testdata/invalid-port"),
+		systemConfigFinder: nullConfigFinder,
+	}
+	_, err := us.Resolve("test.test")
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if err.Error() != `testdata/invalid-port (2, 8): ssh_config: strconv.ParseUint: parsing "notanumber": invalid syntax` {
+		t.Errorf("wrong error: got %v", err)
+	}
+}
+
+func TestResolveKeywordAliases(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"alias first", "Host x\n    PubkeyAcceptedKeyTypes +ssh-rsa\nHost *\n    PubkeyAcceptedAlgorithms ssh-ed25519\n", "+ssh-rsa"},
+		{"current name first", "Host x\n    PubkeyAcceptedAlgorithms ssh-ed25519\nHost *\n    PubkeyAcceptedKeyTypes +ssh-rsa\n", "ssh-ed25519"},
+	}
+	dir := t.TempDir()
+	for i, tt := range tests {
+		cfg, err := Decode(strings.NewReader(tt.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := cfg.Resolve("x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"PubkeyAcceptedAlgorithms", "PubkeyAcceptedKeyTypes"} {
+			if got := r.Get(key); got != tt.want {
+				t.Errorf("%s: Resolve: Get(%s): got %q, want %q", tt.name, key, got, tt.want)
+			}
+			if got, err := cfg.Get("x", key); err != nil || got != tt.want {
+				t.Errorf("%s: Config.Get(%s): got %q, %v, want %q", tt.name, key, got, err, tt.want)
+			}
+			if got, err := r.GetList(key); err != nil || !reflect.DeepEqual(got, []string{tt.want}) {
+				t.Errorf("%s: GetList(%s): got %q, %v", tt.name, key, got, err)
+			}
+		}
+		if got := r.Keys(); !reflect.DeepEqual(got, []string{"pubkeyacceptedalgorithms"}) {
+			t.Errorf("%s: Keys(): got %q", tt.name, got)
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("config%d", i))
+		if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		us := &UserSettings{
+			userConfigFinder:   testConfigFinder(path),
+			systemConfigFinder: nullConfigFinder,
+		}
+		r, err = us.Resolve("x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.GetAll("PubkeyAcceptedKeyTypes"); !reflect.DeepEqual(got, []string{tt.want}) {
+			t.Errorf("%s: UserSettings.Resolve: the default should not be added, got %q", tt.name, got)
+		}
+	}
+}
+
+func TestConfigResolveFinal(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(`Host db
+    HostName DB.Example.com
+    IdentityFile ~/.ssh/id_db
+
+Match final host db.example.com
+    User deploy
+    IdentityFile ~/.ssh/id_db
+    IdentityFile ~/.ssh/id_final
+
+Match canonical
+    Port 2222
+
+Host *
+    User nobody
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ResolveContext only makes a single pass.
+	r, err := cfg.ResolveContext(NewMatchContext("db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.User(); got != "nobody" {
+		t.Errorf("single pass User: got %q, want nobody", got)
+	}
+
+	r, err = cfg.ResolveFinal(NewMatchContext("db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// User was set to "nobody" in the first pass, so the final pass value is
+	// ignored.
+	if got := r.User(); got != "nobody" {
+		t.Errorf("User: got %q, want nobody", got)
+	}
+	if got := r.Get("Port"); got != "2222" {
+		t.Errorf("Port: got %q, want 2222", got)
+	}
+	if got := r.Pass("Port"); got != FinalPass {
+		t.Errorf("Pass(Port): got %d, want %d", got, FinalPass)
+	}
+	if got := r.Pass("HostName"); got != FirstPass {
+		t.Errorf("Pass(HostName): got %d, want %d", got, FirstPass)
+	}
+	if got := r.Pass("Compression"); got != 0 {
+		t.Errorf("Pass(Compression): got %d, want 0", got)
+	}
+	want := []string{"~/.ssh/id_db", "~/.ssh/id_final"}
+	if got := r.GetAll("IdentityFile"); !reflect.DeepEqual(got, want) {
+		t.Errorf("IdentityFile: got %q, want %q", got, want)
+	}
+	if got := r.Passes("IdentityFile"); !reflect.DeepEqual(got, []int{FirstPass, FinalPass}) {
+		t.Errorf("Passes(IdentityFile): got %v", got)
+	}
+}
+
+func TestConfigResolveFinalCanonicalize(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(`Match canonical host web
+    User canonical
+
+Host web
+    CanonicalizeHostname yes
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.ResolveFinal(NewMatchContext("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.User(); got != "canonical" {
+		t.Errorf("User: got %q, want canonical", got)
+	}
+
+	// Without CanonicalizeHostname or "Match final" there is no second pass.
+	r, err = cfg.ResolveFinal(NewMatchContext("db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Has("User") {
+		t.Errorf("expected no User, got %q", r.User())
+	}
+}
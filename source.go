@@ -0,0 +1,130 @@
+package ssh_config
+
+// Source describes where a value in a configuration file came from.
+type Source struct {
+	// Value is the value for the keyword, with surrounding quotes removed.
+	Value string
+	// KV is the line that set the value.
+	KV *KV
+	// File is the path of the file that contains the line, or the empty
+	// string if the Config was read with Decode or DecodeBytes.
+	File string
+	// Position is the position of the line in File.
+	Position Position
+	// Host is the Host or Match block that contains the line. For options
+	// at the top of a file, before any Host or Match line, Host has the
+	// single pattern "*".
+	Host *Host
+	// IncludeChain lists the files whose Include directives led to File,
+	// starting with the outermost file. IncludeChain is empty if the value
+	// was not read from an included file. The first entry is the empty
+	// string if the outermost Config was read with Decode or DecodeBytes.
+	IncludeChain []string
+}
+
+func newSource(kv *KV, file string, host *Host, chain []string) *Source {
+	src := &Source{
+		Value:    kv.Value,
+		KV:       kv,
+		File:     file,
+		Position: kv.Pos(),
+		Host:     host,
+	}
+	if len(chain) > 0 {
+		src.IncludeChain = make([]string, len(chain))
+		copy(src.IncludeChain, chain)
+	}
+	return src
+}
+
+// GetWithSource is like Get, but also reports where the value came from. The
+// returned Source is nil if no value was found.
+func (c *Config) GetWithSource(alias, key string) (*Source, error) {
+	srcs, err := c.lookup(NewMatchContext(alias), nil, key, false, nil)
+	if err != nil || len(srcs) == 0 {
+		return nil, err
+	}
+	return srcs[0], nil
+}
+
+// GetAllWithSource is like GetAll, but returns the Source for each value.
+func (c *Config) GetAllWithSource(alias, key string) ([]*Source, error) {
+	return c.lookup(NewMatchContext(alias), nil, key, true, nil)
+}
+
+// GetWithSource is like GetStrict, but also reports where the value came from.
+// If no configuration file sets key, GetWithSource returns the default value,
+// if any, with a nil Source.
+func (u *UserSettings) GetWithSource(alias, key string) (string, *Source, error) {
+	u.doLoadConfigs()
+	//lint:ignore S1002 I prefer it this way
+	if u.onceErr != nil && u.IgnoreErrors == false {
+		return "", nil, u.onceErr
+	}
+	ctx := u.matchContext(NewMatchContext(alias))
+	seen := newResolvedHost(alias)
+	for _, c := range u.configs() {
+		if c == nil {
+			continue
+		}
+		srcs, err := c.lookup(ctx, seen, key, false, nil)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(srcs) == 0 || srcs[0].Value == "" {
+			continue
+		}
+		if err := validateKV(srcs[0].File, srcs[0].KV); err != nil {
+			return "", nil, err
+		}
+		return srcs[0].Value, srcs[0], nil
+	}
+	return u.Dialect.Default(key), nil, nil
+}
+
+// GetAllWithSource is like GetAllStrict, but returns the Source for each value
+// instead of the value. If no configuration file sets key, GetAllWithSource
+// returns nil.
+func (u *UserSettings) GetAllWithSource(alias, key string) ([]*Source, error) {
+	u.doLoadConfigs()
+	//lint:ignore S1002 I prefer it this way
+	if u.onceErr != nil && u.IgnoreErrors == false {
+		return nil, u.onceErr
+	}
+	ctx := u.matchContext(NewMatchContext(alias))
+	seen := newResolvedHost(alias)
+	for _, c := range u.configs() {
+		if c == nil {
+			continue
+		}
+		srcs, err := c.lookup(ctx, seen, key, true, nil)
+		if err != nil || len(srcs) > 0 {
+			return srcs, err
+		}
+	}
+	return nil, nil
+}
+
+// Source returns where the value returned by Get came from, or nil if key was
+// not set or was set to its default value.
+func (r *ResolvedHost) Source(key string) *Source {
+	vals := r.values[canonicalKey(key)]
+	if len(vals) == 0 {
+		return nil
+	}
+	return vals[0].src
+}
+
+// Sources returns where each value returned by GetAll came from. An entry is
+// nil if the value is a default.
+func (r *ResolvedHost) Sources(key string) []*Source {
+	vals := r.values[canonicalKey(key)]
+	if len(vals) == 0 {
+		return nil
+	}
+	srcs := make([]*Source, len(vals))
+	for i := range vals {
+		srcs[i] = vals[i].src
+	}
+	return srcs
+}
@@ -0,0 +1,205 @@
+package ssh_config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func patternsString(h *Host) string {
+	pats := make([]string, len(h.Patterns))
+	for i, pat := range h.Patterns {
+		pats[i] = pat.String()
+	}
+	return strings.Join(pats, " ")
+}
+
+func TestUserSettingsGetWithSource(t *testing.T) {
+	us := &UserSettings{
+		userConfigFinder: testConfigFinder("testdata/config1"),
+	}
+	val, src, err := us.GetWithSource("wap", "User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "root" {
+		t.Errorf("User: got %q, want root", val)
+	}
+	if src == nil {
+		t.Fatal("User: got nil Source")
+	}
+	if src.File != "testdata/config1" {
+		t.Errorf("File: got %q, want testdata/config1", src.File)
+	}
+	if src.Position.Line != 8 {
+		t.Errorf("Line: got %d, want 8", src.Position.Line)
+	}
+	if got := patternsString(src.Host); got != "wap" {
+		t.Errorf("Host: got %q, want wap", got)
+	}
+	if len(src.IncludeChain) != 0 {
+		t.Errorf("IncludeChain: got %q, want none", src.IncludeChain)
+	}
+
+	val, src, err = us.GetWithSource("wap", "Port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "22" || src != nil {
+		t.Errorf("Port: got %q, %v, want the default and no Source", val, src)
+	}
+}
+
+func TestGetAllWithSource(t *testing.T) {
+	us := &UserSettings{
+		userConfigFinder: testConfigFinder("testdata/identities"),
+	}
+	srcs, err := us.GetAllWithSource("has2identity", "IdentityFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(srcs) != 2 {
+		t.Fatalf("expected 2 sources, got %d", len(srcs))
+	}
+	for i, want := range []struct {
+		value string
+		line  int
+	}{{"f1", 6}, {"f2", 7}} {
+		if srcs[i].Value != want.value || srcs[i].Position.Line != want.line {
+			t.Errorf("source %d: got %q on line %d, want %q on line %d", i, srcs[i].Value, srcs[i].Position.Line, want.value, want.line)
+		}
+	}
+	srcs, err = us.GetAllWithSource("randomhost", "IdentityFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srcs != nil {
+		t.Errorf("expected no sources, got %v", srcs)
+	}
+}
+
+func TestConfigGetWithSource(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(`User top
+
+Host *.example.com !bastion.example.com
+    Port 2222
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := cfg.GetWithSource("web.example.com", "port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src == nil || src.Value != "2222" {
+		t.Fatalf("Port: got %v", src)
+	}
+	if src.File != "" {
+		t.Errorf("File: got %q, want empty", src.File)
+	}
+	if src.Position.Line != 4 || src.Position.Col != 5 {
+		t.Errorf("Position: got %s, want (4, 5)", src.Position)
+	}
+	if got := patternsString(src.Host); got != "*.example.com !bastion.example.com" {
+		t.Errorf("Host: got %q", got)
+	}
+	if src.KV.Key != "Port" {
+		t.Errorf("KV: got %q", src.KV.Key)
+	}
+
+	src, err = cfg.GetWithSource("web.example.com", "User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src == nil || src.Position.Line != 1 || patternsString(src.Host) != "*" {
+		t.Errorf("User: got %+v", src)
+	}
+
+	src, err = cfg.GetWithSource("bastion.example.com", "Port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src != nil {
+		t.Errorf("expected no Source for an unset keyword, got %+v", src)
+	}
+}
+
+func TestResolvedHostSource(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(`Host web
+    IdentityFile ~/.ssh/web
+Host *
+    IdentityFile ~/.ssh/default
+    User admin
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src := r.Source("user"); src == nil || src.Position.Line != 5 || patternsString(src.Host) != "*" {
+		t.Errorf("Source(User): got %+v", src)
+	}
+	if src := r.Source("Port"); src != nil {
+		t.Errorf("Source(Port): got %+v, want nil for a default", src)
+	}
+	srcs := r.Sources("IdentityFile")
+	if len(srcs) != 2 {
+		t.Fatalf("Sources(IdentityFile): got %d, want 2", len(srcs))
+	}
+	if srcs[0].Position.Line != 2 || patternsString(srcs[0].Host) != "web" {
+		t.Errorf("first IdentityFile: got %+v", srcs[0])
+	}
+	if srcs[1].Position.Line != 4 || patternsString(srcs[1].Host) != "*" {
+		t.Errorf("second IdentityFile: got %+v", srcs[1])
+	}
+}
+
+func TestIncludeSource(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping fs write in short mode")
+	}
+	testPath := filepath.Join(homedir(), ".ssh", "kevinburke-ssh-config-test-file")
+	err := os.WriteFile(testPath, includeFile, 0644)
+	if err != nil {
+		t.Skipf("couldn't write SSH config file: %v", err.Error())
+	}
+	defer os.Remove(testPath)
+	us := &UserSettings{
+		userConfigFinder: testConfigFinder("testdata/include"),
+	}
+	val, src, err := us.GetWithSource("kevinburke.ssh_config.test.example.com", "Port")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "4567" || src == nil {
+		t.Fatalf("expected to find Port=4567 in included file, got %q", val)
+	}
+	if src.File != testPath {
+		t.Errorf("File: got %q, want %q", src.File, testPath)
+	}
+	if src.Position.Line != 5 {
+		t.Errorf("Line: got %d, want 5", src.Position.Line)
+	}
+	if len(src.IncludeChain) != 1 || src.IncludeChain[0] != "testdata/include" {
+		t.Errorf("IncludeChain: got %q, want [testdata/include]", src.IncludeChain)
+	}
+
+	cfg, err := parseFile("testdata/include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.Resolve("kevinburke.ssh_config.test.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src = r.Source("Port")
+	if src == nil || src.File != testPath {
+		t.Fatalf("ResolvedHost Source: got %+v", src)
+	}
+	if len(src.IncludeChain) != 1 || src.IncludeChain[0] != "testdata/include" {
+		t.Errorf("ResolvedHost IncludeChain: got %q, want [testdata/include]", src.IncludeChain)
+	}
+}
@@ -0,0 +1,176 @@
+package ssh_config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TraceKind identifies the step of resolution that a TraceEvent describes.
+type TraceKind int
+
+const (
+	// TraceBlock is recorded for every Host or Match block that is
+	// evaluated, whether or not it matched.
+	TraceBlock TraceKind = iota + 1
+	// TraceInclude is recorded for every file read by an Include directive
+	// in a matching block, and for Include directives that match no files.
+	TraceInclude
+	// TraceSet is recorded when a value from a config file is used.
+	TraceSet
+	// TraceIgnore is recorded when a value is ignored because the keyword
+	// was already set.
+	TraceIgnore
+	// TraceCanonicalize is recorded when the host name is canonicalized
+	// before the final pass.
+	TraceCanonicalize
+)
+
+func (k TraceKind) String() string {
+	switch k {
+	case TraceBlock:
+		return "block"
+	case TraceInclude:
+		return "include"
+	case TraceSet:
+		return "set"
+	case TraceIgnore:
+		return "ignore"
+	case TraceCanonicalize:
+		return "canonicalize"
+	}
+	return fmt.Sprintf("TraceKind(%d)", int(k))
+}
+
+// TraceEvent is a single step in the resolution of a host, similar to the
+// "Applying options for" lines that "ssh -vvv" prints. See
+// ResolvedHost.Trace.
+type TraceEvent struct {
+	Kind TraceKind
+	// Pass is FirstPass or FinalPass.
+	Pass int
+	// File and Position locate the block, Include directive or keyword that
+	// the event is about. File is empty if the Config was read with Decode
+	// or DecodeBytes.
+	File     string
+	Position Position
+	// Host is the block that was evaluated, or that contains the Include
+	// directive or keyword.
+	Host *Host
+	// Matched reports whether the block matched. It is only set for
+	// TraceBlock events.
+	Matched bool
+	// Reason explains the event: which pattern or criterion decided whether
+	// a block matched, why an Include read no files, or why a value was
+	// ignored.
+	Reason string
+	// Key and Value are the keyword and value for TraceSet and TraceIgnore
+	// events. For TraceInclude events, Value is the file that was read, and
+	// for TraceCanonicalize events it is the canonical host name.
+	Key   string
+	Value string
+}
+
+// location describes a position in a file the way ssh does in its debug
+// output, e.g. "/home/user/.ssh/config line 7".
+func location(file string, pos Position) string {
+	switch {
+	case pos.Invalid() && file == "":
+		return "config"
+	case pos.Invalid():
+		return file
+	case file == "":
+		return fmt.Sprintf("line %d", pos.Line)
+	}
+	return fmt.Sprintf("%s line %d", file, pos.Line)
+}
+
+// describeBlock returns the Host or Match line for h, without any comment.
+func describeBlock(h *Host) string {
+	if h.invalid != nil {
+		return strings.TrimSpace(h.invalid.String())
+	}
+	if h.implicit {
+		return "options at the top of the file"
+	}
+	var buf strings.Builder
+	if h.isMatch {
+		buf.WriteString("Match")
+		for _, c := range h.Criteria {
+			buf.WriteByte(' ')
+			buf.WriteString(c.String())
+		}
+		return buf.String()
+	}
+	buf.WriteString("Host")
+	for _, pat := range h.Patterns {
+		buf.WriteByte(' ')
+		buf.WriteString(pat.String())
+	}
+	return buf.String()
+}
+
+// String describes e on a single line, e.g.
+//
+//	/home/user/.ssh/config line 7: applying options for Host web: "web" matches pattern "web"
+func (e TraceEvent) String() string {
+	var line string
+	loc := location(e.File, e.Position)
+	switch e.Kind {
+	case TraceBlock:
+		if e.Matched {
+			line = fmt.Sprintf("%s: applying options for %s: %s", loc, describeBlock(e.Host), e.Reason)
+		} else {
+			line = fmt.Sprintf("%s: skipping %s: %s", loc, describeBlock(e.Host), e.Reason)
+		}
+	case TraceInclude:
+		if e.Value == "" {
+			line = fmt.Sprintf("%s: Include: %s", loc, e.Reason)
+		} else {
+			line = fmt.Sprintf("%s: reading included file %s", loc, e.Value)
+		}
+	case TraceSet:
+		line = fmt.Sprintf("%s: setting %s %s", loc, e.Key, e.Value)
+	case TraceIgnore:
+		line = fmt.Sprintf("%s: ignoring %s %s: %s", loc, e.Key, e.Value, e.Reason)
+	case TraceCanonicalize:
+		line = fmt.Sprintf("canonicalized host name: %s", e.Reason)
+	default:
+		line = fmt.Sprintf("%s: %s %s", loc, e.Kind, e.Reason)
+	}
+	if e.Pass == FinalPass {
+		line = "final pass: " + line
+	}
+	return line
+}
+
+// explainPatterns is like matchPatterns, but also explains the result.
+func explainPatterns(patterns []*Pattern, s string) (bool, string) {
+	var matched *Pattern
+	for _, pat := range patterns {
+		if !pat.regex.MatchString(s) {
+			continue
+		}
+		if pat.not {
+			return false, fmt.Sprintf("%q matches negated pattern %q", s, pat.String())
+		}
+		if matched == nil {
+			matched = pat
+		}
+	}
+	if matched == nil {
+		return false, fmt.Sprintf("%q matches no pattern", s)
+	}
+	return true, fmt.Sprintf("%q matches pattern %q", s, matched.String())
+}
+
+// explainMatch is like matchesContext, but also explains the result.
+func (h *Host) explainMatch(ctx *MatchContext) (bool, string, error) {
+	if h.invalid != nil {
+		return false, "the line could not be parsed", nil
+	}
+	if !h.isMatch {
+		ok, reason := explainPatterns(h.Patterns, ctx.host())
+		return ok, reason, nil
+	}
+	return matchCriteria(h.Criteria, ctx)
+}
@@ -0,0 +1,187 @@
+package ssh_config
+
+import (
+	"strings"
+	"testing"
+)
+
+var traceConfig = `User default
+
+Host *.example.com !bastion.example.com
+    Port 2222
+
+Host web.example.com
+    Port 22
+    IdentityFile ~/.ssh/web
+
+Match user deploy
+    Port 2022
+
+Match exec "true"
+    Port 2023
+
+Host *
+    IdentityFile ~/.ssh/web
+`
+
+func TestResolveTrace(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(traceConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.Resolve("web.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`config: applying options for options at the top of the file: "web.example.com" matches pattern "*"`,
+		`line 1: setting User default`,
+		`line 3: applying options for Host *.example.com !bastion.example.com: "web.example.com" matches pattern "*.example.com"`,
+		`line 4: setting Port 2222`,
+		`line 6: applying options for Host web.example.com: "web.example.com" matches pattern "web.example.com"`,
+		`line 7: ignoring Port 22: already set to "2222" at line 4`,
+		`line 8: setting IdentityFile ~/.ssh/web`,
+		`line 10: skipping Match user deploy: criterion "user deploy" does not match "default"`,
+		`line 13: skipping Match exec "true": criterion "exec \"true\"" was not run: no Executor is set`,
+		`line 16: applying options for Host *: "web.example.com" matches pattern "*"`,
+		`line 17: setting IdentityFile ~/.ssh/web`,
+	}
+	if len(r.Trace) != len(want) {
+		for _, ev := range r.Trace {
+			t.Log(ev)
+		}
+		t.Fatalf("got %d events, want %d", len(r.Trace), len(want))
+	}
+	for i := range want {
+		if got := r.Trace[i].String(); got != want[i] {
+			t.Errorf("event %d:\ngot  %s\nwant %s", i, got, want[i])
+		}
+	}
+
+	r, err = cfg.Resolve("bastion.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := r.Trace[2]
+	if ev.Kind != TraceBlock || ev.Matched || ev.Position.Line != 3 {
+		t.Errorf("bastion: got %+v", ev)
+	}
+	if want := `"bastion.example.com" matches negated pattern "!bastion.example.com"`; ev.Reason != want {
+		t.Errorf("bastion: got reason %q, want %q", ev.Reason, want)
+	}
+}
+
+func TestResolveTraceFinalPass(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(`Host web web.example.com
+    CanonicalizeHostname yes
+    CanonicalDomains example.com
+    IdentityFile ~/.ssh/web
+
+Match canonical
+    Port 2222
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := NewMatchContext("web")
+	ctx.Resolver = newFakeResolver()
+	r, err := cfg.ResolveFinal(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, ev := range r.Trace {
+		lines = append(lines, ev.String())
+	}
+	got := strings.Join(lines, "\n")
+	for _, want := range []string{
+		`line 6: skipping Match canonical: criterion "canonical" does not match`,
+		`canonicalized host name: "web" => "web.example.com"`,
+		`final pass: line 4: ignoring IdentityFile ~/.ssh/web: already added in the first pass`,
+		`final pass: line 6: applying options for Match canonical: all criteria match`,
+		`final pass: line 7: setting Port 2222`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("trace does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestResolveTraceAgreesWithMatches(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(traceConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, alias := range []string{"web.example.com", "bastion.example.com", "db.example.com", "other"} {
+		r, err := cfg.Resolve(alias)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ev := range r.Trace {
+			if ev.Kind != TraceBlock {
+				continue
+			}
+			ok, err := ev.Host.matchesContext(NewMatchContext(alias))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// "Match user" is evaluated against the User set earlier in the
+			// file, which MatchesContext does not know about.
+			if ev.Host.isMatch {
+				continue
+			}
+			if ok != ev.Matched {
+				t.Errorf("%s: %s: trace says %t, Matches says %t", alias, describeBlock(ev.Host), ev.Matched, ok)
+			}
+		}
+	}
+}
+
+func TestResolveTraceNegatedExec(t *testing.T) {
+	cfg, err := Decode(strings.NewReader("Match !exec \"false\"\n    Port 2024\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfg.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ev TraceEvent
+	for _, e := range r.Trace {
+		if e.Kind == TraceBlock && e.Host.isMatch {
+			ev = e
+		}
+	}
+	if ev.Host == nil || ev.Matched {
+		t.Fatalf("got %+v, want a Match block that did not match", ev)
+	}
+	if want := `criterion "!exec \"false\"" was not run: no Executor is set`; ev.Reason != want {
+		t.Errorf("got reason %q, want %q", ev.Reason, want)
+	}
+	if port, err := cfg.Get("web", "Port"); err != nil || port != "" {
+		t.Errorf("Get(Port): got %q, %v, want the block to be skipped as in the trace", port, err)
+	}
+}
+
+func TestResolveTraceInclude(t *testing.T) {
+	cfg := NewConfig()
+	inc, err := NewIncludeDirective([]string{"kevinburke-ssh-config-missing-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Hosts[0].Nodes = append(cfg.Hosts[0].Nodes, inc)
+	r, err := cfg.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Trace) != 2 {
+		t.Fatalf("got %d events, want 2: %v", len(r.Trace), r.Trace)
+	}
+	ev := r.Trace[1]
+	if ev.Kind != TraceInclude || ev.Value != "" {
+		t.Errorf("got %+v", ev)
+	}
+	if want := "config: Include: no files match kevinburke-ssh-config-missing-*"; ev.String() != want {
+		t.Errorf("got %q, want %q", ev.String(), want)
+	}
+}
@@ -2,6 +2,7 @@ package ssh_config
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -20,65 +21,339 @@ func Default(keyword string) string {
 	return defaults[strings.ToLower(keyword)]
 }
 
-// Arguments where the value must be "yes" or "no" and *only* yes or no.
-var yesnos = map[string]bool{
-	strings.ToLower("BatchMode"):                        true,
-	strings.ToLower("CanonicalizeFallbackLocal"):        true,
-	strings.ToLower("CheckHostIP"):                      true,
-	strings.ToLower("ClearAllForwardings"):              true,
-	strings.ToLower("Compression"):                      true,
-	strings.ToLower("EnableSSHKeysign"):                 true,
-	strings.ToLower("ExitOnForwardFailure"):             true,
-	strings.ToLower("ForwardX11"):                       true,
-	strings.ToLower("ForwardX11Trusted"):                true,
-	strings.ToLower("GatewayPorts"):                     true,
-	strings.ToLower("GSSAPIAuthentication"):             true,
-	strings.ToLower("GSSAPIDelegateCredentials"):        true,
-	strings.ToLower("HostbasedAuthentication"):          true,
-	strings.ToLower("IdentitiesOnly"):                   true,
-	strings.ToLower("KbdInteractiveAuthentication"):     true,
-	strings.ToLower("NoHostAuthenticationForLocalhost"): true,
-	strings.ToLower("PasswordAuthentication"):           true,
-	strings.ToLower("PermitLocalCommand"):               true,
-	strings.ToLower("PubkeyAuthentication"):             true,
-	strings.ToLower("StreamLocalBindUnlink"):            true,
-	strings.ToLower("TCPKeepAlive"):                     true,
-	strings.ToLower("UseKeychain"):                      true,
-	strings.ToLower("VisualHostKey"):                    true,
-}
-
-var uints = map[string]bool{
-	strings.ToLower("CanonicalizeMaxDots"):     true,
-	strings.ToLower("ConnectionAttempts"):      true,
-	strings.ToLower("ConnectTimeout"):          true,
-	strings.ToLower("NumberOfPasswordPrompts"): true,
-	strings.ToLower("Port"):                    true,
-	strings.ToLower("ServerAliveCountMax"):     true,
-	strings.ToLower("ServerAliveInterval"):     true,
-}
-
-func mustBeYesOrNo(lkey string) bool {
-	return yesnos[lkey]
-}
-
-func mustBeUint(lkey string) bool {
-	return uints[lkey]
+// DefaultAll is like Default, but returns each default value for keyword as a
+// separate element. Some keywords default to a list of files: IdentityFile,
+// which has no single default, and UserKnownHostsFile and
+// GlobalKnownHostsFile, whose defaults Default returns joined with spaces.
+// For other keywords DefaultAll returns Default(keyword) in a slice, or nil if
+// the keyword has no default.
+func DefaultAll(keyword string) []string {
+	if list, ok := listDefaults[strings.ToLower(keyword)]; ok {
+		return append([]string(nil), list...)
+	}
+	if def := Default(keyword); def != "" {
+		return []string{def}
+	}
+	return nil
 }
 
+// validate checks that val is a valid value for key, using the type and
+// allowed values in the keyword catalog. Keywords that are not in the
+// catalog, and deprecated keywords, are not checked. The returned error is a
+// *ValidationError without a file or position; see validateKV.
 func validate(key, val string) error {
 	lkey := strings.ToLower(key)
-	if mustBeYesOrNo(lkey) && (val != "yes" && val != "no") {
-		return fmt.Errorf("ssh_config: value for key %q must be 'yes' or 'no', got %q", key, val)
+	i, ok := keywordIndex[lkey]
+	if !ok || keywords[i].Deprecated != "" {
+		return nil
+	}
+	kw := &keywords[i]
+	if contains(kw.Values, val) {
+		return nil
+	}
+	var err error
+	if check, ok := valueCheckers[strings.ToLower(kw.Name)]; ok {
+		err = check(kw, val)
+	} else {
+		err = checkType(kw, val)
+	}
+	if err == nil {
+		return nil
+	}
+	ve, ok := err.(*ValidationError)
+	if !ok {
+		ve = &ValidationError{Msg: err.Error(), Err: err}
+	}
+	ve.Key = key
+	ve.Value = val
+	return ve
+}
+
+// validateKV is like validate, but the returned error also records file and
+// the position of kv's value.
+func validateKV(file string, kv *KV) error {
+	err := validate(kv.Key, kv.Value)
+	if err != nil {
+		ve := err.(*ValidationError)
+		ve.File = file
+		ve.Pos = kv.valuePos()
+	}
+	return err
+}
+
+// Validate checks every value in c, and in the files that c includes, against
+// the keyword catalog, and returns a ValidationErrors listing each value that
+// is not valid for its keyword, in the order they appear. Validate checks
+// every block, not just the blocks that match a particular host, so it is
+// suitable for rejecting a bad config before it is deployed.
+//
+// Keywords that are not in the catalog are not checked.
+func (c *Config) Validate() error {
+	var errs ValidationErrors
+	c.validate(&errs)
+	if len(errs) == 0 {
+		return nil
 	}
-	if mustBeUint(lkey) {
-		_, err := strconv.ParseUint(val, 10, 64)
-		if err != nil {
-			return fmt.Errorf("ssh_config: %v", err)
+	return errs
+}
+
+func (c *Config) validate(errs *ValidationErrors) {
+	for _, host := range c.Hosts {
+		for _, node := range host.Nodes {
+			switch t := node.(type) {
+			case *KV:
+				if err := validateKV(c.filename, t); err != nil {
+					*errs = append(*errs, err.(*ValidationError))
+				}
+			case *Include:
+				t.mu.Lock()
+				for _, match := range t.matches {
+					if cfg := t.files[match]; cfg != nil {
+						cfg.validate(errs)
+					}
+				}
+				t.mu.Unlock()
+			}
 		}
 	}
+}
+
+// invalidValue returns a *ValidationError for a value that does not have the
+// form that kw requires.
+func invalidValue(kw *Keyword, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Msg: fmt.Sprintf("value for key %q must be ", kw.Name) + fmt.Sprintf(format, args...)}
+}
+
+// checkType checks val against kw.Type.
+func checkType(kw *Keyword, val string) error {
+	switch kw.Type {
+	case ValueFlag:
+		if !containsFold(flagValues, val) {
+			return &ValidationError{Msg: fmt.Sprintf("value for key %q must be 'yes' or 'no', got %q", kw.Name, val)}
+		}
+	case ValueUint:
+		if _, err := strconv.ParseUint(val, 10, 64); err != nil {
+			return &ValidationError{Msg: err.Error(), Err: err}
+		}
+	case ValueDuration:
+		if _, err := parseTime(val); err != nil {
+			return invalidValue(kw, "a time interval such as 30, 10m or 1h30m%s, got %q", orValues(kw.Values), val)
+		}
+	case ValueEnum:
+		if !containsFold(kw.Values, val) {
+			return invalidValue(kw, "one of %s, got %q", strings.Join(kw.Values, ", "), val)
+		}
+	case ValueAlgorithms:
+		return checkAlgorithms(kw, val)
+	case ValueForward:
+		return checkForward(kw, val)
+	}
 	return nil
 }
 
+// flagValues are the values that ssh accepts for a flag, ignoring case. See
+// parse_flag in readconf.c.
+var flagValues = []string{"yes", "no", "true", "false"}
+
+// orValues formats values as ", or one of a, b" for use in an error message,
+// or returns the empty string if values is empty.
+func orValues(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return ", or one of " + strings.Join(values, ", ")
+}
+
+func contains(values []string, val string) bool {
+	for _, v := range values {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, val string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, val) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueCheckers validate keywords whose values have a form that the catalog
+// type does not describe. They are keyed by lowercased keyword.
+var valueCheckers = map[string]func(kw *Keyword, val string) error{
+	strings.ToLower("AddKeysToAgent"):         checkAddKeysToAgent,
+	strings.ToLower("EscapeChar"):             checkEscapeChar,
+	strings.ToLower("IPQoS"):                  checkIPQoS,
+	strings.ToLower("ObscureKeystrokeTiming"): checkObscureKeystrokeTiming,
+	strings.ToLower("Port"):                   checkPort,
+	strings.ToLower("RekeyLimit"):             checkRekeyLimit,
+	strings.ToLower("StreamLocalBindMask"):    checkBindMask,
+	strings.ToLower("TunnelDevice"):           checkTunnelDevice,
+}
+
+// checkAddKeysToAgent accepts yes, no, ask or confirm, optionally followed by
+// a key lifetime, or a lifetime alone, e.g. "confirm 1h".
+func checkAddKeysToAgent(kw *Keyword, val string) error {
+	fields := strings.Fields(val)
+	if len(fields) == 1 || len(fields) == 2 {
+		_, err := parseTime(fields[len(fields)-1])
+		if len(fields) == 1 && err == nil {
+			return nil
+		}
+		if containsFold(kw.Values, fields[0]) && (len(fields) == 1 || err == nil) {
+			return nil
+		}
+	}
+	return invalidValue(kw, "one of %s, optionally followed by a time interval, got %q", strings.Join(kw.Values, ", "), val)
+}
+
+// checkEscapeChar accepts a single character, "^" followed by a character, or
+// "none".
+func checkEscapeChar(kw *Keyword, val string) error {
+	if len(val) == 1 || (len(val) == 2 && val[0] == '^') {
+		return nil
+	}
+	return invalidValue(kw, "a single character, ^ followed by a character, or none, got %q", val)
+}
+
+// ipqosValues are the names accepted by IPQoS, from ipqos_parse() in misc.c.
+var ipqosValues = []string{
+	"af11", "af12", "af13", "af21", "af22", "af23",
+	"af31", "af32", "af33", "af41", "af42", "af43",
+	"cs0", "cs1", "cs2", "cs3", "cs4", "cs5", "cs6", "cs7",
+	"ef", "le", "lowdelay", "throughput", "reliability", "none",
+}
+
+// checkIPQoS accepts one or two DSCP names or numbers.
+func checkIPQoS(kw *Keyword, val string) error {
+	fields := strings.Fields(val)
+	ok := len(fields) == 1 || len(fields) == 2
+	for _, f := range fields {
+		if containsFold(ipqosValues, f) {
+			continue
+		}
+		if n, err := strconv.ParseUint(f, 0, 8); err != nil || n > 255 {
+			ok = false
+		}
+	}
+	if !ok {
+		return invalidValue(kw, "one or two of %s or a number, got %q", strings.Join(ipqosValues, ", "), val)
+	}
+	return nil
+}
+
+// checkObscureKeystrokeTiming accepts yes, no or "interval:" followed by a
+// number of milliseconds.
+func checkObscureKeystrokeTiming(kw *Keyword, val string) error {
+	if ms := strings.TrimPrefix(val, "interval:"); ms != val {
+		if _, err := strconv.ParseUint(ms, 10, 32); err == nil {
+			return nil
+		}
+	}
+	return invalidValue(kw, "yes, no or interval:milliseconds, got %q", val)
+}
+
+// checkPort accepts a port number between 1 and 65535.
+func checkPort(kw *Keyword, val string) error {
+	if err := checkType(kw, val); err != nil {
+		return err
+	}
+	if n, _ := strconv.ParseUint(val, 10, 64); n == 0 || n > 65535 {
+		return invalidValue(kw, "a port number between 1 and 65535, got %q", val)
+	}
+	return nil
+}
+
+// checkRekeyLimit accepts an amount of data, such as 1G, or "default",
+// optionally followed by a time interval or "none".
+func checkRekeyLimit(kw *Keyword, val string) error {
+	fields := strings.Fields(val)
+	ok := len(fields) == 1 || len(fields) == 2
+	if ok && fields[0] != "default" {
+		ok = isSize(fields[0])
+	}
+	if ok && len(fields) == 2 && fields[1] != "none" {
+		_, err := parseTime(fields[1])
+		ok = err == nil
+	}
+	if !ok {
+		return invalidValue(kw, "an amount of data such as 1G or default, optionally followed by a time interval or none, got %q", val)
+	}
+	return nil
+}
+
+// isSize reports whether s is a number with an optional K, M or G suffix.
+func isSize(s string) bool {
+	s = strings.TrimRight(s, "KMGkmg")
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
+
+// checkBindMask accepts an octal file creation mask.
+func checkBindMask(kw *Keyword, val string) error {
+	if n, err := strconv.ParseUint(val, 8, 32); err != nil || n > 0777 {
+		return invalidValue(kw, "an octal mask such as 0177, got %q", val)
+	}
+	return nil
+}
+
+// checkTunnelDevice accepts "local[:remote]", where each device is a number
+// or "any".
+func checkTunnelDevice(kw *Keyword, val string) error {
+	parts := strings.Split(val, ":")
+	ok := len(parts) <= 2
+	for _, p := range parts {
+		if p == "any" {
+			continue
+		}
+		if _, err := strconv.ParseUint(p, 10, 32); err != nil {
+			ok = false
+		}
+	}
+	if !ok {
+		return invalidValue(kw, "local_tun[:remote_tun], where each is a number or any, got %q", val)
+	}
+	return nil
+}
+
+// checkAlgorithms accepts a comma-separated list of algorithm names, which
+// may start with "+" to append to the default list, "-" to remove from it,
+// or "^" to move to the front of it.
+func checkAlgorithms(kw *Keyword, val string) error {
+	list := val
+	if list != "" && strings.IndexByte("+-^", list[0]) >= 0 {
+		list = list[1:]
+	}
+	for _, name := range strings.Split(list, ",") {
+		if name == "" {
+			return invalidValue(kw, "a comma-separated list of algorithms without empty entries, got %q", val)
+		}
+		for _, r := range name {
+			if !isAlgorithmChar(r) {
+				return invalidValue(kw, "a comma-separated list of algorithms, got %q (invalid character %q)", val, r)
+			}
+		}
+	}
+	return nil
+}
+
+// isAlgorithmChar reports whether r may appear in an algorithm name or in a
+// pattern that matches algorithm names.
+func isAlgorithmChar(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+		strings.ContainsRune("@.-_*?", r)
+}
+
+// checkForward accepts a forwarding specification; see ParseForward.
+func checkForward(kw *Keyword, val string) error {
+	_, err := ParseForward(kw.Name, val)
+	return err
+}
+
 // defaultPKAlg is the default value for HostKeyAlgorithms,
 // HostbasedAcceptedAlgorithms, and PubkeyAcceptedAlgorithms.
 // Sourced from KEX_DEFAULT_PK_ALG in myproposal.h.
@@ -199,18 +474,81 @@ var defaultIdentityFiles = []string{
 	"~/.ssh/id_ed25519_sk",
 }
 
+// listDefaults are the default values for keywords that default to a list of
+// files. See DefaultAll.
+var listDefaults = map[string][]string{
+	strings.ToLower("GlobalKnownHostsFile"): {"/etc/ssh/ssh_known_hosts", "/etc/ssh/ssh_known_hosts2"},
+	strings.ToLower("IdentityFile"):         defaultIdentityFiles,
+	strings.ToLower("UserKnownHostsFile"):   {"~/.ssh/known_hosts", "~/.ssh/known_hosts2"},
+}
+
 // these directives support multiple items that can be collected
 // across multiple files
 var pluralDirectives = map[string]bool{
-	"CertificateFile": true,
-	"IdentityFile":    true,
-	"DynamicForward":  true,
-	"RemoteForward":   true,
-	"SendEnv":         true,
-	"SetEnv":          true,
+	strings.ToLower("CertificateFile"): true,
+	strings.ToLower("IdentityFile"):    true,
+	strings.ToLower("DynamicForward"):  true,
+	strings.ToLower("LocalForward"):    true,
+	strings.ToLower("RemoteForward"):   true,
+	strings.ToLower("SendEnv"):         true,
+	strings.ToLower("SetEnv"):          true,
 }
 
 // SupportsMultiple reports whether a directive can be specified multiple times.
 func SupportsMultiple(key string) bool {
 	return pluralDirectives[strings.ToLower(key)]
 }
+
+// maxTime is the largest time interval, in seconds, that ssh accepts.
+const maxTime = math.MaxInt32
+
+// parseTime converts an OpenSSH time format such as "90", "10m" or "1h30m" to
+// a number of seconds. See the TIME FORMATS section of sshd_config(5), and
+// convtime() in misc.c. As in convtime(), values larger than maxTime are an
+// error.
+func parseTime(s string) (int64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty time value")
+	}
+	var total, cur int64
+	hasDigits := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= '0' && c <= '9' {
+			cur = cur*10 + int64(c-'0')
+			if cur > maxTime {
+				return 0, fmt.Errorf("time value %q is too large", s)
+			}
+			hasDigits = true
+			continue
+		}
+		if !hasDigits {
+			return 0, fmt.Errorf("invalid time value %q", s)
+		}
+		var mult int64
+		switch c {
+		case 's', 'S':
+			mult = 1
+		case 'm', 'M':
+			mult = 60
+		case 'h', 'H':
+			mult = 60 * 60
+		case 'd', 'D':
+			mult = 24 * 60 * 60
+		case 'w', 'W':
+			mult = 7 * 24 * 60 * 60
+		default:
+			return 0, fmt.Errorf("invalid time value %q", s)
+		}
+		if cur > (maxTime-total)/mult {
+			return 0, fmt.Errorf("time value %q is too large", s)
+		}
+		total += cur * mult
+		cur = 0
+		hasDigits = false
+	}
+	if cur > maxTime-total {
+		return 0, fmt.Errorf("time value %q is too large", s)
+	}
+	return total + cur, nil
+}
@@ -1,6 +1,11 @@
 package ssh_config
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -10,9 +15,63 @@ var validateTests = []struct {
 	err string
 }{
 	{"IdentitiesOnly", "yes", ""},
-	{"IdentitiesOnly", "Yes", `ssh_config: value for key "IdentitiesOnly" must be 'yes' or 'no', got "Yes"`},
+	{"IdentitiesOnly", "Yes", ""},
+	{"Compression", "true", ""},
+	{"Compression", "FALSE", ""},
+	{"IdentitiesOnly", "maybe", `ssh_config: value for key "IdentitiesOnly" must be 'yes' or 'no', got "maybe"`},
 	{"Port", "22", ``},
 	{"Port", "yes", `ssh_config: strconv.ParseUint: parsing "yes": invalid syntax`},
+	{"Port", "0", `ssh_config: value for key "Port" must be a port number between 1 and 65535, got "0"`},
+	{"Port", "65536", `ssh_config: value for key "Port" must be a port number between 1 and 65535, got "65536"`},
+	{"PubkeyAuthentication", "host-bound", ""},
+	{"StrictHostKeyChecking", "accept-new", ""},
+	{"StrictHostKeyChecking", "maybe", `ssh_config: value for key "StrictHostKeyChecking" must be one of yes, accept-new, no, off, ask, true, false, got "maybe"`},
+	{"LogLevel", "debug3", ""},
+	{"LogLevel", "LOUD", `ssh_config: value for key "LogLevel" must be one of QUIET, FATAL, ERROR, INFO, VERBOSE, DEBUG, DEBUG1, DEBUG2, DEBUG3, got "LOUD"`},
+	{"CanonicalizeHostname", "true", ""},
+	{"CanonicalizeHostname", "always", ""},
+	{"CanonicalizeHostname", "none", `ssh_config: value for key "CanonicalizeHostname" must be one of yes, no, true, false, always, got "none"`},
+	{"AddressFamily", "ipv5", `ssh_config: value for key "AddressFamily" must be one of any, inet, inet6, got "ipv5"`},
+	{"AddKeysToAgent", "confirm", ""},
+	{"AddKeysToAgent", "confirm 1h", ""},
+	{"AddKeysToAgent", "30m", ""},
+	{"AddKeysToAgent", "sometimes", `ssh_config: value for key "AddKeysToAgent" must be one of yes, no, ask, confirm, true, false, optionally followed by a time interval, got "sometimes"`},
+	{"ConnectTimeout", "1m30s", ""},
+	{"ConnectTimeout", "none", ""},
+	{"ServerAliveInterval", "soon", `ssh_config: value for key "ServerAliveInterval" must be a time interval such as 30, 10m or 1h30m, got "soon"`},
+	{"ServerAliveInterval", "99999999999999999999999", `ssh_config: value for key "ServerAliveInterval" must be a time interval such as 30, 10m or 1h30m, got "99999999999999999999999"`},
+	{"ControlPersist", "yes", ""},
+	{"ControlPersist", "10m", ""},
+	{"Ciphers", "+aes128-cbc,3des-cbc", ""},
+	{"KexAlgorithms", "-*sha1", ""},
+	{"HostKeyAlgorithms", "^ssh-ed25519", ""},
+	{"MACs", "hmac-sha2-256,,hmac-sha1", `ssh_config: value for key "MACs" must be a comma-separated list of algorithms without empty entries, got "hmac-sha2-256,,hmac-sha1"`},
+	{"Ciphers", "aes128-ctr aes256-ctr", `ssh_config: value for key "Ciphers" must be a comma-separated list of algorithms, got "aes128-ctr aes256-ctr" (invalid character ' ')`},
+	{"LocalForward", "8080 localhost:80", ""},
+	{"LocalForward", "127.0.0.1:8080 [::1]:80", ""},
+	{"LocalForward", "/tmp/local.sock /var/run/remote.sock", ""},
+	{"LocalForward", "8080", `ssh_config: value for key "LocalForward" must be [bind_address:]port host:hostport, got "8080"`},
+	{"LocalForward", "8080 localhost:http", `ssh_config: value for key "LocalForward" must be [bind_address:]port host:hostport, got "8080 localhost:http"`},
+	{"RemoteForward", "8080", ""},
+	{"RemoteForward", "*:8080 localhost:80", ""},
+	{"DynamicForward", "localhost:1080", ""},
+	{"DynamicForward", "1080 localhost:80", `ssh_config: value for key "DynamicForward" must be [bind_address:]port, got "1080 localhost:80"`},
+	{"IPQoS", "af21 cs1", ""},
+	{"IPQoS", "lowdelay throughput reliability", `ssh_config: value for key "IPQoS" must be one or two of af11, af12, af13, af21, af22, af23, af31, af32, af33, af41, af42, af43, cs0, cs1, cs2, cs3, cs4, cs5, cs6, cs7, ef, le, lowdelay, throughput, reliability, none or a number, got "lowdelay throughput reliability"`},
+	{"IPQoS", "0x10", ""},
+	{"RekeyLimit", "1G 1h", ""},
+	{"RekeyLimit", "default none", ""},
+	{"RekeyLimit", "lots", `ssh_config: value for key "RekeyLimit" must be an amount of data such as 1G or default, optionally followed by a time interval or none, got "lots"`},
+	{"EscapeChar", "^]", ""},
+	{"EscapeChar", "none", ""},
+	{"EscapeChar", "ab", `ssh_config: value for key "EscapeChar" must be a single character, ^ followed by a character, or none, got "ab"`},
+	{"StreamLocalBindMask", "0177", ""},
+	{"StreamLocalBindMask", "0999", `ssh_config: value for key "StreamLocalBindMask" must be an octal mask such as 0177, got "0999"`},
+	{"TunnelDevice", "any:3", ""},
+	{"ObscureKeystrokeTiming", "interval:80", ""},
+	{"ProxyJump", "anything goes", ""},
+	{"RSAAuthentication", "maybe", ""},
+	{"NotAKeyword", "whatever", ""},
 }
 
 func TestValidate(t *testing.T) {
@@ -31,6 +90,113 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+// multistateTests lists the values that ssh accepts for keywords that it
+// parses with the multistate_* tables in readconf.c.
+var multistateTests = []struct {
+	key    string
+	values []string
+}{
+	{"AddKeysToAgent", []string{"yes", "no", "true", "false", "ask", "confirm"}},
+	{"CanonicalizeHostname", []string{"yes", "no", "true", "false", "always"}},
+	{"ControlMaster", []string{"yes", "no", "true", "false", "ask", "auto", "autoask"}},
+	{"ControlPersist", []string{"yes", "no", "true", "false"}},
+	{"ForwardAgent", []string{"yes", "no", "true", "false"}},
+	{"PubkeyAuthentication", []string{"yes", "no", "true", "false", "unbound", "host-bound"}},
+	{"RequestTTY", []string{"yes", "no", "true", "false", "force", "auto"}},
+	{"StrictHostKeyChecking", []string{"yes", "no", "true", "false", "ask", "off", "accept-new"}},
+	{"Tunnel", []string{"yes", "no", "true", "false", "ethernet", "point-to-point"}},
+	{"UpdateHostKeys", []string{"yes", "no", "true", "false", "ask"}},
+	{"VerifyHostKeyDNS", []string{"yes", "no", "true", "false", "ask"}},
+}
+
+func TestMultistateValues(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range multistateTests {
+		for _, val := range tt.values {
+			data := "Host *\n    " + tt.key + " " + val + "\n"
+			cfg, err := Decode(strings.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("%s %s: Validate: %v", tt.key, val, err)
+			}
+			path := filepath.Join(dir, tt.key+"-"+val)
+			if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			us := &UserSettings{
+				userConfigFinder:   testConfigFinder(path),
+				systemConfigFinder: nullConfigFinder,
+			}
+			if got, err := us.GetStrict("web", tt.key); err != nil || got != val {
+				t.Errorf("%s %s: GetStrict: got %q, %v", tt.key, val, got, err)
+			}
+			if _, err := us.Resolve("web"); err != nil {
+				t.Errorf("%s %s: Resolve: %v", tt.key, val, err)
+			}
+		}
+	}
+}
+
+func TestDefaultsValidate(t *testing.T) {
+	for _, kw := range Keywords() {
+		if kw.Default == "" {
+			continue
+		}
+		if err := validate(kw.Name, kw.Default); err != nil {
+			t.Errorf("default for %s is not valid: %v", kw.Name, err)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg, err := Decode(strings.NewReader(`Port 22
+Host web
+    StrictHostKeyChecking maybe
+    LocalForward 8080
+
+Match user deploy
+    LogLevel = LOUD
+    ForwardAgent yes
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cfg.Validate()
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	want := []struct {
+		key string
+		pos Position
+	}{
+		{"StrictHostKeyChecking", Position{3, 27}},
+		{"LocalForward", Position{4, 18}},
+		{"LogLevel", Position{7, 16}},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(want), err)
+	}
+	for i := range want {
+		if errs[i].Key != want[i].key || errs[i].Pos != want[i].pos {
+			t.Errorf("error %d: got %s at %v, want %s at %v", i, errs[i].Key, errs[i].Pos, want[i].key, want[i].pos)
+		}
+	}
+	if want := `(3, 27): ssh_config: value for key "StrictHostKeyChecking" must be one of yes, accept-new, no, off, ask, true, false, got "maybe"`; errs[0].Error() != want {
+		t.Errorf("got %q, want %q", errs[0].Error(), want)
+	}
+
+	cfg, err = Decode(strings.NewReader("Host *\n    Port 22\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: got %v, want nil", err)
+	}
+}
+
 func TestDefault(t *testing.T) {
 	if v := Default("VisualHostKey"); v != "no" {
 		t.Errorf("Default(%q): got %v, want 'no'", "VisualHostKey", v)
@@ -42,3 +208,37 @@ func TestDefault(t *testing.T) {
 		t.Errorf("Default(%q): got %v, want ''", "notfound", v)
 	}
 }
+
+func TestDefaultAll(t *testing.T) {
+	if got := DefaultAll("identityfile"); !reflect.DeepEqual(got, defaultIdentityFiles) {
+		t.Errorf("DefaultAll(IdentityFile): got %v, want %v", got, defaultIdentityFiles)
+	}
+	if got, want := DefaultAll("Port"), []string{"22"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DefaultAll(Port): got %v, want %v", got, want)
+	}
+	if got := DefaultAll("notfound"); got != nil {
+		t.Errorf("DefaultAll(notfound): got %v, want nil", got)
+	}
+	// Lists that Default also knows about must agree with it.
+	for key, list := range listDefaults {
+		if def, ok := defaults[key]; ok && def != strings.Join(list, " ") {
+			t.Errorf("Default(%s) = %q, but DefaultAll returns %q", key, def, list)
+		}
+	}
+	// DefaultAll returns a copy.
+	DefaultAll("IdentityFile")[0] = "changed"
+	if defaultIdentityFiles[0] == "changed" {
+		t.Error("DefaultAll returned the package's default list")
+	}
+}
+
+func TestSupportsMultiple(t *testing.T) {
+	for _, key := range []string{"IdentityFile", "identityfile", "LocalForward", "SendEnv"} {
+		if !SupportsMultiple(key) {
+			t.Errorf("SupportsMultiple(%q): got false, want true", key)
+		}
+	}
+	if SupportsMultiple("Port") {
+		t.Errorf("SupportsMultiple(%q): got true, want false", "Port")
+	}
+}